@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+var authTypes = []string{"basic", "bearer", "digest", "custom"}
+
+// setupAuth sets the Authorization header by the -auth value according to the -auth-type,
+// the digest one is done by the transport wrapped by wrapDigestTransport.
+func setupAuth(req *Request) {
+	if !inSlice(authType, authTypes) {
+		log.Fatalf("unknown auth type %q, should be one of %s", authType, strings.Join(authTypes, "|"))
+	}
+
+	switch authType {
+	case "basic":
+		req.Header("Authorization", "Basic "+basicCredentials(auth))
+	case "bearer":
+		req.Header("Authorization", "Bearer "+readCredentials(auth))
+	case "custom":
+		req.Header("Authorization", readCredentials(auth))
+	}
+}
+
+// basicCredentials returns the base64 encoded user:pass, the value is taken as already encoded
+// only when it has no colon and its decoded form has one.
+func basicCredentials(v string) string {
+	if !strings.Contains(v, ":") {
+		for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding} {
+			if d, err := enc.DecodeString(v); err == nil && bytes.Contains(d, []byte(":")) {
+				return base64.StdEncoding.EncodeToString(d)
+			}
+		}
+	}
+
+	return base64.StdEncoding.EncodeToString([]byte(v))
+}
+
+// readCredentials reads the credentials from the file by @file, or the environment variable by $NAME,
+// otherwise the value itself is returned.
+func readCredentials(v string) string {
+	switch {
+	case strings.HasPrefix(v, "@"):
+		data, err := os.ReadFile(v[1:])
+		if err != nil {
+			log.Fatalf("read credentials file %s: %v", v[1:], err)
+		}
+		return strings.TrimSpace(string(data))
+	case strings.HasPrefix(v, "$"):
+		name := strings.Trim(v[1:], "{}")
+		val, ok := os.LookupEnv(name)
+		if !ok {
+			log.Fatalf("credentials env $%s not found", name)
+		}
+		return strings.TrimSpace(val)
+	default:
+		return v
+	}
+}
+
+// wrapDigestTransport wraps the request transport to do the HTTP Digest Access Authentication.
+func wrapDigestTransport(req *Request) {
+	if authType == "digest" && auth != "" {
+		user, pass, _ := strings.Cut(auth, ":")
+		req.Transport = &DigestTransport{User: user, Password: pass, Transport: req.Transport}
+	}
+}
+
+// DigestTransport is a http.RoundTripper doing the HTTP Digest Access Authentication (RFC 7616),
+// with qop auth and auth-int, MD5, SHA-256 and SHA-512-256 (and their -sess variants).
+// The challenge is remembered and reused with increasing nonce count for the following requests.
+type DigestTransport struct {
+	User, Password string
+	Transport      http.RoundTripper
+
+	lock      sync.Mutex
+	challenge *digestChallenge
+	nc        int
+}
+
+type digestChallenge struct {
+	Realm, Nonce, Opaque, Algorithm, Qop string
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *DigestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+
+	t.lock.Lock()
+	c := t.challenge
+	t.lock.Unlock()
+
+	// the remembered challenge is used preemptively, a new challenge is taken when it is stale or absent.
+	rsp, err := t.send(req, body, c)
+	if err != nil || rsp.StatusCode != http.StatusUnauthorized {
+		return rsp, err
+	}
+	if c = t.newChallenge(rsp); c == nil {
+		return rsp, nil
+	}
+	drainBody(rsp)
+
+	return t.send(req, body, c)
+}
+
+// Sign implements RequestSigner, signs by the remembered challenge without counting the nonce,
+// it does nothing before the server challenges.
+func (t *DigestTransport) Sign(r *http.Request) error {
+	t.lock.Lock()
+	c, nc := t.challenge, t.nc+1
+	t.lock.Unlock()
+	if c == nil {
+		return nil
+	}
+
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(r.Body); err != nil {
+			return err
+		}
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	r.Header.Set("Authorization", c.authorization(t.User, t.Password, r.Method, r.URL.RequestURI(), body, nc, randomHex(16)))
+	return nil
+}
+
+func drainBody(rsp *http.Response) {
+	_, _ = io.Copy(io.Discard, rsp.Body)
+	rsp.Body.Close()
+}
+
+// newChallenge parses the strongest supported digest challenge from the response, and resets the nonce count.
+func (t *DigestTransport) newChallenge(rsp *http.Response) *digestChallenge {
+	var best *digestChallenge
+	for _, v := range rsp.Header.Values("WWW-Authenticate") {
+		scheme, params, _ := strings.Cut(strings.TrimSpace(v), " ")
+		if !strings.EqualFold(scheme, "Digest") {
+			continue
+		}
+		m := parseAuthParams(params)
+		c := &digestChallenge{Realm: m["realm"], Nonce: m["nonce"], Opaque: m["opaque"], Algorithm: m["algorithm"], Qop: m["qop"]}
+		if c.Algorithm == "" {
+			c.Algorithm = "MD5"
+		}
+		if digestHash(c.Algorithm) == nil {
+			continue
+		}
+		if best == nil || digestStrength(c.Algorithm) > digestStrength(best.Algorithm) {
+			best = c
+		}
+	}
+
+	if best == nil {
+		return nil
+	}
+
+	t.lock.Lock()
+	t.challenge, t.nc = best, 0
+	t.lock.Unlock()
+	return best
+}
+
+func (t *DigestTransport) send(req *http.Request, body []byte, c *digestChallenge) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	if body != nil {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	}
+
+	if c != nil {
+		t.lock.Lock()
+		t.nc++
+		nc := t.nc
+		t.lock.Unlock()
+
+		r.Header.Set("Authorization", c.authorization(t.User, t.Password, r.Method, r.URL.RequestURI(), body, nc, randomHex(16)))
+	}
+
+	return t.Transport.RoundTrip(r)
+}
+
+func (c *digestChallenge) authorization(user, pass, method, uri string, body []byte, nc int, cnonce string) string {
+	alg := strings.ToUpper(c.Algorithm)
+	h := func(s string) string {
+		x := digestHash(alg)
+		x.Write([]byte(s))
+		return hex.EncodeToString(x.Sum(nil))
+	}
+
+	ha1 := h(user + ":" + c.Realm + ":" + pass)
+	if strings.HasSuffix(alg, "-SESS") {
+		ha1 = h(ha1 + ":" + c.Nonce + ":" + cnonce)
+	}
+
+	qop := ""
+	for _, q := range strings.Split(c.Qop, ",") {
+		switch q = strings.TrimSpace(q); q {
+		case "auth":
+			qop = q
+		case "auth-int":
+			if qop == "" {
+				qop = q
+			}
+		}
+	}
+
+	ha2 := h(method + ":" + uri)
+	if qop == "auth-int" {
+		ha2 = h(method + ":" + uri + ":" + h(string(body)))
+	}
+
+	ncValue := fmt.Sprintf("%08x", nc)
+	response := h(ha1 + ":" + c.Nonce + ":" + ha2)
+	if qop != "" {
+		response = h(ha1 + ":" + c.Nonce + ":" + ncValue + ":" + cnonce + ":" + qop + ":" + ha2)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `Digest username="%s", realm="%s", nonce="%s", uri="%s", algorithm=%s, response="%s"`,
+		user, c.Realm, c.Nonce, uri, c.Algorithm, response)
+	if c.Opaque != "" {
+		fmt.Fprintf(&b, `, opaque="%s"`, c.Opaque)
+	}
+	if qop != "" {
+		fmt.Fprintf(&b, `, qop=%s, nc=%s, cnonce="%s"`, qop, ncValue, cnonce)
+	}
+	return b.String()
+}
+
+func digestHash(algorithm string) hash.Hash {
+	switch strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS") {
+	case "MD5":
+		return md5.New()
+	case "SHA-256":
+		return sha256.New()
+	case "SHA-512-256":
+		return sha512.New512_256()
+	default:
+		return nil
+	}
+}
+
+func digestStrength(algorithm string) int {
+	switch strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS") {
+	case "SHA-512-256":
+		return 3
+	case "SHA-256":
+		return 2
+	default:
+		return 1
+	}
+}
+
+// parseAuthParams parses the auth params like realm="a, b", nonce="x", qop="auth,auth-int", algorithm=MD5.
+func parseAuthParams(s string) map[string]string {
+	m := map[string]string{}
+	for s = strings.TrimSpace(s); s != ""; {
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimSpace(s[eq+1:])
+
+		var val string
+		if strings.HasPrefix(s, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			if i < len(s) {
+				i++
+			}
+			val, s = b.String(), s[i:]
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			val, s = strings.TrimSpace(s[:end]), s[end:]
+		}
+
+		m[key] = val
+		s = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(s), ","))
+	}
+
+	return m
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseAuthParams(t *testing.T) {
+	m := parseAuthParams(`realm="a, \"b\"", qop="auth,auth-int", nonce=abc, algorithm=SHA-256`)
+	if m["realm"] != `a, "b"` || m["qop"] != "auth,auth-int" || m["nonce"] != "abc" || m["algorithm"] != "SHA-256" {
+		t.Errorf("bad params: %v", m)
+	}
+}
+
+func TestDigestAuthorization(t *testing.T) {
+	// the example in RFC 2617 3.5
+	c := &digestChallenge{
+		Realm: "testrealm@host.com", Nonce: "dcd98b7102dd2f0e8b11d0f600bfb0c093",
+		Opaque: "5ccc069c403ebaf9f0171e9517f40e41", Algorithm: "MD5", Qop: "auth,auth-int",
+	}
+	a := c.authorization("Mufasa", "Circle Of Life", "GET", "/dir/index.html", nil, 1, "0a4f113b")
+	if !strings.Contains(a, `response="6629fae49393a05397450978507c4ef1"`) || !strings.Contains(a, "nc=00000001") {
+		t.Errorf("bad authorization: %s", a)
+	}
+}
+
+func TestBasicCredentials(t *testing.T) {
+	cases := map[string]string{
+		"u:p":      "dTpw",
+		"dTpw":     "dTpw",
+		"admin":    "YWRtaW4=",
+		"abcd":     "YWJjZA==",
+		"YWRtaW4=": "WVdSdGFXND0=",
+	}
+	for v, want := range cases {
+		if got := basicCredentials(v); got != want {
+			t.Errorf("basicCredentials(%q) = %q, want %q", v, got, want)
+		}
+	}
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AWS Signature Version 4 payload variants.
+const (
+	awsPayloadSigned    = "signed"
+	awsPayloadUnsigned  = "unsigned"
+	awsPayloadStreaming = "streaming"
+
+	awsAlgorithm          = "AWS4-HMAC-SHA256"
+	awsUnsignedPayload    = "UNSIGNED-PAYLOAD"
+	awsStreamingPayload   = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	awsEmptyPayloadSHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	awsTimeFormat         = "20060102T150405Z"
+
+	// awsChunkSize is the size of the chunks in the streaming payload.
+	awsChunkSize = 64 * 1024
+)
+
+// AWSCredentials is the credentials to sign the request.
+type AWSCredentials struct {
+	AccessKeyID, SecretAccessKey, SessionToken string
+}
+
+// AWSSigner signs the request by AWS Signature Version 4.
+type AWSSigner struct {
+	Region, Service string
+	// Payload is signed, unsigned or streaming.
+	Payload     string
+	Credentials AWSCredentials
+
+	now func() time.Time
+}
+
+// wrapAWSSigV4Transport wraps the request transport to sign the final requests by AWS Signature Version 4.
+func wrapAWSSigV4Transport(req *Request) {
+	if awsSigV4 == "" {
+		return
+	}
+
+	s, err := NewAWSSigner(awsSigV4, awsPayload)
+	if err != nil {
+		log.Fatalf("aws sigv4: %v", err)
+	}
+
+	req.Transport = &SignTransport{Signer: s, Transport: req.Transport}
+}
+
+// NewAWSSigner creates the signer by the spec region/service (or service only with the region from the env or profile),
+// the credentials are loaded from the standard env vars or the profile files.
+func NewAWSSigner(spec, payload string) (*AWSSigner, error) {
+	if payload == "" {
+		payload = awsPayloadSigned
+	}
+	if !inSlice(payload, []string{awsPayloadSigned, awsPayloadUnsigned, awsPayloadStreaming}) {
+		return nil, fmt.Errorf("unknown payload %q, should be signed|unsigned|streaming", payload)
+	}
+
+	s := &AWSSigner{Payload: payload, now: time.Now}
+	if region, service, ok := strings.Cut(spec, "/"); ok {
+		s.Region, s.Service = region, service
+	} else {
+		s.Service = spec
+	}
+
+	profile := loadAWSProfile()
+	if s.Region == "" {
+		s.Region = awsFirstNonEmpty(os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), profile["region"])
+	}
+	if s.Region == "" || s.Service == "" {
+		return nil, fmt.Errorf("bad %q, should be like us-east-1/s3", spec)
+	}
+
+	s.Credentials = AWSCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if s.Credentials.AccessKeyID == "" || s.Credentials.SecretAccessKey == "" {
+		s.Credentials = AWSCredentials{
+			AccessKeyID:     profile["aws_access_key_id"],
+			SecretAccessKey: profile["aws_secret_access_key"],
+			SessionToken:    profile["aws_session_token"],
+		}
+	}
+	if s.Credentials.AccessKeyID == "" || s.Credentials.SecretAccessKey == "" {
+		return nil, errors.New("credentials not found in $AWS_ACCESS_KEY_ID/$AWS_SECRET_ACCESS_KEY or the profile files")
+	}
+
+	return s, nil
+}
+
+func awsFirstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// loadAWSProfile loads the profile $AWS_PROFILE (default) from the shared credentials file and the config file,
+// the credentials file takes precedence.
+func loadAWSProfile() map[string]string {
+	name := awsFirstNonEmpty(os.Getenv("AWS_PROFILE"), "default")
+	home, _ := os.UserHomeDir()
+	credentialsFile := awsFirstNonEmpty(os.Getenv("AWS_SHARED_CREDENTIALS_FILE"), filepath.Join(home, ".aws", "credentials"))
+	configFile := awsFirstNonEmpty(os.Getenv("AWS_CONFIG_FILE"), filepath.Join(home, ".aws", "config"))
+
+	profile := readINISection(credentialsFile, name)
+	section := "profile " + name
+	if name == "default" {
+		section = name
+	}
+	for k, v := range readINISection(configFile, section) {
+		if _, ok := profile[k]; !ok {
+			profile[k] = v
+		}
+	}
+
+	return profile
+}
+
+// readINISection reads the key values in the section of the INI file.
+func readINISection(file, section string) map[string]string {
+	m := map[string]string{}
+	f, err := os.Open(file)
+	if err != nil {
+		return m
+	}
+	defer f.Close()
+
+	in := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			in = strings.TrimSpace(line[1:len(line)-1]) == section
+		case in:
+			if k, v, ok := strings.Cut(line, "="); ok {
+				m[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+			}
+		}
+	}
+
+	return m
+}
+
+// awsUnsignedHeaders are not signed, because they are probably changed by the proxies or the transport.
+var awsUnsignedHeaders = map[string]bool{
+	"Authorization": true, "User-Agent": true, "X-Amzn-Trace-Id": true, "Expect": true,
+	"Connection": true, "Transfer-Encoding": true, "Content-Length": true,
+}
+
+// Sign signs the request, the body is read into memory for the signed payload.
+func (s *AWSSigner) Sign(r *http.Request) error {
+	now := s.now().UTC()
+	amzDate := now.Format(awsTimeFormat)
+	scope := now.Format("20060102") + "/" + s.Region + "/" + s.Service + "/aws4_request"
+
+	r.Header.Del("Authorization")
+	r.Header.Set("X-Amz-Date", amzDate)
+	if s.Credentials.SessionToken != "" {
+		r.Header.Set("X-Amz-Security-Token", s.Credentials.SessionToken)
+	}
+
+	var payloadHash string
+	switch s.Payload {
+	case awsPayloadUnsigned:
+		payloadHash = awsUnsignedPayload
+	case awsPayloadStreaming:
+		if r.Body == nil || r.Body == http.NoBody {
+			payloadHash = awsEmptyPayloadSHA256
+			break
+		}
+		if r.ContentLength < 0 {
+			return errors.New("aws sigv4: streaming payload requires the known content length, which conflicts with -gzip and CHUNKED")
+		}
+		payloadHash = awsStreamingPayload
+		r.Header.Set("X-Amz-Decoded-Content-Length", strconv.FormatInt(r.ContentLength, 10))
+		if ce := r.Header.Get("Content-Encoding"); ce != "" {
+			r.Header.Set("Content-Encoding", "aws-chunked,"+ce)
+		} else {
+			r.Header.Set("Content-Encoding", "aws-chunked")
+		}
+	default:
+		var body []byte
+		if r.Body != nil && r.Body != http.NoBody {
+			var err error
+			if body, err = io.ReadAll(r.Body); err != nil {
+				return fmt.Errorf("aws sigv4: %w", err)
+			}
+			r.Body.Close()
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			r.ContentLength = int64(len(body))
+			r.TransferEncoding = nil
+		}
+		payloadHash = awsSHA256Hex(body)
+	}
+
+	if s.Service == "s3" || s.Payload != awsPayloadSigned {
+		r.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	if payloadHash == awsStreamingPayload {
+		r.ContentLength = awsChunkedLength(r.ContentLength)
+	}
+
+	canonical, signedHeaders := s.canonicalRequest(r, payloadHash)
+	stringToSign := awsAlgorithm + "\n" + amzDate + "\n" + scope + "\n" + awsSHA256Hex([]byte(canonical))
+	key := s.signingKey(now)
+	signature := hex.EncodeToString(awsHMAC(key, stringToSign))
+
+	if HasPrintOption(printDebug) {
+		log.Printf("aws sigv4 canonical request:\n%s", canonical)
+		log.Printf("aws sigv4 string to sign:\n%s", stringToSign)
+	}
+
+	r.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		awsAlgorithm, s.Credentials.AccessKeyID, scope, signedHeaders, signature))
+
+	if payloadHash == awsStreamingPayload {
+		r.Body = &awsChunkedReader{
+			src: r.Body, key: key, prevSig: signature,
+			prefix: "AWS4-HMAC-SHA256-PAYLOAD\n" + amzDate + "\n" + scope + "\n",
+		}
+	}
+
+	return nil
+}
+
+func (s *AWSSigner) canonicalRequest(r *http.Request, payloadHash string) (canonical, signedHeaders string) {
+	host := r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+
+	headers := map[string]string{"host": host}
+	if payloadHash == awsStreamingPayload {
+		// the content length of the streaming payload is always sent and required to be signed.
+		headers["content-length"] = strconv.FormatInt(r.ContentLength, 10)
+	}
+	for k, vv := range r.Header {
+		if awsUnsignedHeaders[http.CanonicalHeaderKey(k)] {
+			continue
+		}
+		values := make([]string, len(vv))
+		for i, v := range vv {
+			values[i] = strings.Join(strings.Fields(v), " ")
+		}
+		headers[strings.ToLower(k)] = strings.Join(values, ",")
+	}
+
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders = strings.Join(names, ";")
+
+	canonical = strings.Join([]string{
+		r.Method,
+		s.canonicalURI(r.URL.Path),
+		awsCanonicalQuery(r.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	return canonical, signedHeaders
+}
+
+// canonicalURI encodes each path segment, and encodes twice for the services other than S3.
+func (s *AWSSigner) canonicalURI(path string) string {
+	if path == "" {
+		return "/"
+	}
+
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		seg = awsEscape(seg)
+		if s.Service != "s3" {
+			seg = awsEscape(seg)
+		}
+		segments[i] = seg
+	}
+	return strings.Join(segments, "/")
+}
+
+func awsCanonicalQuery(query map[string][]string) string {
+	var pairs []string
+	for k, vv := range query {
+		for _, v := range vv {
+			pairs = append(pairs, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape encodes all the bytes except the unreserved characters A-Z a-z 0-9 - _ . ~.
+func awsEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func (s *AWSSigner) signingKey(t time.Time) []byte {
+	k := awsHMAC([]byte("AWS4"+s.Credentials.SecretAccessKey), t.Format("20060102"))
+	k = awsHMAC(k, s.Region)
+	k = awsHMAC(k, s.Service)
+	return awsHMAC(k, "aws4_request")
+}
+
+func awsHMAC(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func awsSHA256Hex(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// awsChunkedLength returns the encoded length of the streaming payload for the decoded length.
+func awsChunkedLength(decoded int64) int64 {
+	chunkLen := func(n int64) int64 {
+		// hex(size);chunk-signature=<64 hex>\r\n<data>\r\n
+		return int64(len(strconv.FormatInt(n, 16))) + int64(len(";chunk-signature=")) + 64 + 2 + n + 2
+	}
+
+	full := decoded / awsChunkSize
+	length := full * chunkLen(awsChunkSize)
+	if rest := decoded % awsChunkSize; rest > 0 {
+		length += chunkLen(rest)
+	}
+	return length + chunkLen(0)
+}
+
+// awsChunkedReader encodes the source into the signed chunks of the streaming payload.
+type awsChunkedReader struct {
+	src     io.ReadCloser
+	key     []byte
+	prefix  string
+	prevSig string
+
+	buf  bytes.Buffer
+	done bool
+}
+
+func (c *awsChunkedReader) Read(p []byte) (int, error) {
+	for c.buf.Len() == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+
+		chunk := make([]byte, awsChunkSize)
+		n, err := io.ReadFull(c.src, chunk)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, err
+		}
+		c.writeChunk(chunk[:n])
+		if n == 0 {
+			c.done = true
+		}
+	}
+
+	return c.buf.Read(p)
+}
+
+func (c *awsChunkedReader) writeChunk(data []byte) {
+	stringToSign := c.prefix + c.prevSig + "\n" + awsEmptyPayloadSHA256 + "\n" + awsSHA256Hex(data)
+	c.prevSig = hex.EncodeToString(awsHMAC(c.key, stringToSign))
+
+	fmt.Fprintf(&c.buf, "%x;chunk-signature=%s\r\n", len(data), c.prevSig)
+	c.buf.Write(data)
+	c.buf.WriteString("\r\n")
+}
+
+func (c *awsChunkedReader) Close() error { return c.src.Close() }
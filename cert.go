@@ -0,0 +1,282 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bingoohuang/gg/pkg/ss"
+	"github.com/emmansun/gmsm/sm2"
+	"github.com/emmansun/gmsm/smx509"
+)
+
+const certUsage = `Usage: gurl cert [-cert-dir .] [-cert-alg ecdsa] [-cert-days 365] COMMAND [NAME...]
+Commands:
+  ca                  create the TLS CA, ca.pem and ca.key, the key by -cert-alg rsa|ecdsa
+  server [HOST...]    issue the TLS server certificate server.pem and server.key, default for localhost,127.0.0.1
+  client [NAME]       issue the TLS client certificate client.pem and client.key, default name gurl
+  tlcp-ca             create the SM2 CA, sm2-ca.pem and sm2-ca.key
+  tlcp-server [HOST...] issue the TLCP server sign/enc certificates server-sign.pem, server-sign.key, server-enc.pem, server-enc.key
+  tlcp-client [NAME]  issue the TLCP client sign/enc certificates client-sign.pem, client-sign.key, client-enc.pem, client-enc.key
+The CA is created automatically when absent, existing files are never overwritten.`
+
+// runCertCommand runs the gurl cert subcommands to create the local CA and issue the certificates, returns the exit code.
+func runCertCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Println(certUsage)
+		return 1
+	}
+
+	var err error
+	switch cmd, names := args[0], args[1:]; cmd {
+	case "ca":
+		_, err = createCA(false)
+	case "tlcp-ca":
+		_, err = createCA(true)
+	case "server", "client", "tlcp-server", "tlcp-client":
+		err = issueCertificates(cmd, names)
+	default:
+		fmt.Println(certUsage)
+		return 1
+	}
+
+	if err != nil {
+		log.Printf("cert: %v", err)
+		return 1
+	}
+	return 0
+}
+
+type certAuthority struct {
+	cert *smx509.Certificate
+	key  crypto.Signer
+}
+
+// createCA creates the TLS CA, or the SM2 CA for TLCP.
+func createCA(sm bool) (*certAuthority, error) {
+	name, alg, cn := "ca", certAlg, "gurl local CA"
+	if sm {
+		name, alg, cn = "sm2-ca", "sm2", "gurl local SM2 CA"
+	}
+
+	key, err := generateKey(alg)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl := certTemplate(cn, 10*certDays)
+	tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+	tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+
+	der, err := smx509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeCertificate(name, der, key); err != nil {
+		return nil, err
+	}
+
+	cert, err := smx509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("CERT=%s\n", filepath.Join(certDir, name+".pem"))
+	return &certAuthority{cert: cert, key: key}, nil
+}
+
+// loadCA loads the CA, or creates it when absent.
+func loadCA(sm bool) (*certAuthority, error) {
+	name := ss.If(sm, "sm2-ca", "ca")
+	certFile, keyFile := filepath.Join(certDir, name+".pem"), filepath.Join(certDir, name+".key")
+
+	certPEM, err := os.ReadFile(certFile)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("CA %s not found, create it", certFile)
+		return createCA(sm)
+	} else if err != nil {
+		return nil, err
+	}
+
+	cert, err := smx509.ParseCertificatePEM(certPEM)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", certFile, err)
+	}
+
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("no private key found in %s", keyFile)
+	}
+	key, err := parsePrivateKey(block)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", keyFile, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported CA key %T", key)
+	}
+
+	return &certAuthority{cert: cert, key: signer}, nil
+}
+
+// issueCertificates issues the TLS server/client certificate, or the TLCP sign/enc certificates.
+func issueCertificates(cmd string, names []string) error {
+	sm := strings.HasPrefix(cmd, "tlcp-")
+	server := strings.HasSuffix(cmd, "server")
+
+	if len(names) == 0 {
+		names = []string{"gurl"}
+		if server {
+			names = []string{"localhost", "127.0.0.1"}
+		}
+	}
+
+	role := ss.If(server, "server", "client")
+	suffixes := []string{".pem", ".key"}
+	if sm {
+		suffixes = []string{"-sign.pem", "-sign.key", "-enc.pem", "-enc.key"}
+	}
+	var files []string
+	for _, f := range suffixes {
+		files = append(files, filepath.Join(certDir, role+f))
+	}
+	// all the files are checked before anything is generated, even the CA, so no half issued TLCP pairs are left.
+	if err := checkAbsent(files...); err != nil {
+		return err
+	}
+
+	ca, err := loadCA(sm)
+	if err != nil {
+		return err
+	}
+
+	if !sm {
+		if err := issueCertificate(ca, role, certAlg, names, server, x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment); err != nil {
+			return err
+		}
+		if !server {
+			fmt.Printf("TLS_CLIENT_CERT=%s\nTLS_CLIENT_KEY=%s\n", files[0], files[1])
+		}
+		return nil
+	}
+
+	// TLCP uses the sign certificate for the signature, and the enc one for the key exchange.
+	if err := issueCertificate(ca, role+"-sign", "sm2", names, server, x509.KeyUsageDigitalSignature); err != nil {
+		return err
+	}
+	encUsage := x509.KeyUsageKeyEncipherment | x509.KeyUsageDataEncipherment | x509.KeyUsageKeyAgreement
+	if err := issueCertificate(ca, role+"-enc", "sm2", names, server, encUsage); err != nil {
+		return err
+	}
+
+	if !server {
+		fmt.Printf("TLCP_CERTS=%s\n", strings.Join(files, ","))
+	}
+	return nil
+}
+
+func issueCertificate(ca *certAuthority, name, alg string, names []string, server bool, usage x509.KeyUsage) error {
+	key, err := generateKey(alg)
+	if err != nil {
+		return err
+	}
+
+	tmpl := certTemplate(names[0], certDays)
+	tmpl.KeyUsage = usage
+	if server {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		for _, n := range names {
+			if ip := net.ParseIP(n); ip != nil {
+				tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+			} else {
+				tmpl.DNSNames = append(tmpl.DNSNames, n)
+			}
+		}
+	} else {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+
+	der, err := smx509.CreateCertificate(rand.Reader, tmpl, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		return err
+	}
+	return writeCertificate(name, der, key)
+}
+
+func generateKey(alg string) (crypto.Signer, error) {
+	switch strings.ToLower(alg) {
+	case "rsa":
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case "", "ecdsa":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "sm2":
+		return sm2.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unknown key algorithm %s, should be one of rsa|ecdsa|sm2", alg)
+	}
+}
+
+func certTemplate(cn string, days int) *x509.Certificate {
+	serial, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{"gurl"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.AddDate(0, 0, days),
+	}
+}
+
+// checkAbsent checks that none of the files exists, so that the existing certificates are never overwritten.
+func checkAbsent(files ...string) error {
+	for _, f := range files {
+		if _, err := os.Stat(f); err == nil {
+			return fmt.Errorf("%s already exists, remove it first", f)
+		}
+	}
+	return nil
+}
+
+// writeCertificate writes the name.pem and the PKCS#8 name.key into the -cert-dir, never overwrites the existing ones.
+func writeCertificate(name string, der []byte, key crypto.Signer) error {
+	keyDER, err := smx509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(certDir, 0o755); err != nil {
+		return err
+	}
+
+	certFile, keyFile := filepath.Join(certDir, name+".pem"), filepath.Join(certDir, name+".key")
+	if err := checkAbsent(certFile, keyFile); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		return err
+	}
+
+	log.Printf("created %s and %s", certFile, keyFile)
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCertCommand(t *testing.T) {
+	certDir = t.TempDir()
+	if code := runCertCommand([]string{"server", "localhost", "127.0.0.1"}); code != 0 {
+		t.Fatal("issue server certificate failed")
+	}
+	if code := runCertCommand([]string{"tlcp-client", "bob"}); code != 0 {
+		t.Fatal("issue TLCP client certificates failed")
+	}
+	if code := runCertCommand([]string{"ca"}); code == 0 {
+		t.Error("existing CA should not be overwritten")
+	}
+
+	cert, err := loadClientCertificate(filepath.Join(certDir, "server.pem"), filepath.Join(certDir, "server.key"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+	caPEM, _ := os.ReadFile(filepath.Join(certDir, "ca.pem"))
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(caPEM)
+	if _, err := leaf.Verify(x509.VerifyOptions{DNSName: "localhost", Roots: pool}); err != nil {
+		t.Errorf("verify server certificate: %v", err)
+	}
+
+	spec := filepath.Join(certDir, "client-sign.pem") + "," + filepath.Join(certDir, "client-sign.key") + "," +
+		filepath.Join(certDir, "client-enc.pem") + "," + filepath.Join(certDir, "client-enc.key")
+	certs, err := loadTLCPCertificates(spec, "")
+	if err != nil || len(certs) != 2 || certs[1].Leaf.Subject.CommonName != "bob" {
+		t.Errorf("load TLCP certificates: %v", err)
+	}
+}
+
+func TestCertCommandTLCPExisting(t *testing.T) {
+	certDir = t.TempDir()
+	encKey := filepath.Join(certDir, "server-enc.key")
+	if err := os.WriteFile(encKey, []byte("left"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := runCertCommand([]string{"tlcp-server"}); code == 0 {
+		t.Fatal("existing enc key should not be overwritten")
+	}
+	// nothing is generated, neither the sign certificate nor the CA.
+	entries, _ := os.ReadDir(certDir)
+	if len(entries) != 1 {
+		t.Errorf("files generated: %v", entries)
+	}
+}
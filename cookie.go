@@ -0,0 +1,413 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+// SessionCookie is a cookie stored in the session.
+type SessionCookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Domain   string `json:"domain"`
+	Path     string `json:"path"`
+	Expires  int64  `json:"expires,omitempty"` // unix seconds, 0 for session cookies
+	HostOnly bool   `json:"hostOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+	HttpOnly bool   `json:"httpOnly,omitempty"`
+	SameSite string `json:"sameSite,omitempty"`
+}
+
+// Expired tells whether the cookie is expired at the time t.
+func (c *SessionCookie) Expired(t time.Time) bool {
+	return c.Expires != 0 && c.Expires < t.Unix()
+}
+
+// CookieStore keeps the cookies which can be persisted, like in sessions or cookie jar files.
+type CookieStore struct {
+	Cookies []*SessionCookie `json:"cookies,omitempty"`
+
+	lock sync.Mutex
+}
+
+// RemoveExpired removes the expired cookies.
+func (s *CookieStore) RemoveExpired() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	cookies := s.Cookies[:0]
+	for _, c := range s.Cookies {
+		if !c.Expired(now) {
+			cookies = append(cookies, c)
+		}
+	}
+	s.Cookies = cookies
+}
+
+// NewJar creates a cookie jar loaded with the stored cookies, which records the cookies set by the server back.
+func (s *CookieStore) NewJar() *recordingJar {
+	jar, _ := cookiejar.New(nil)
+	now := time.Now()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, c := range s.Cookies {
+		if c.Expired(now) {
+			continue
+		}
+
+		hc := &http.Cookie{Name: c.Name, Value: c.Value, Path: c.Path, Secure: c.Secure, HttpOnly: c.HttpOnly}
+		if c.Expires != 0 {
+			hc.Expires = time.Unix(c.Expires, 0)
+		}
+		if !c.HostOnly {
+			hc.Domain = c.Domain
+		}
+		jar.SetCookies(cookieURL(c), []*http.Cookie{hc})
+	}
+
+	return &recordingJar{Jar: jar, store: s}
+}
+
+// cookieURL returns the URL which the cookie is applicable to.
+func cookieURL(c *SessionCookie) *url.URL {
+	scheme := "http"
+	if c.Secure {
+		scheme = "https"
+	}
+	return &url.URL{Scheme: scheme, Host: c.Domain, Path: c.Path}
+}
+
+func (s *CookieStore) setCookie(sc *SessionCookie) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	found := -1
+	for i, old := range s.Cookies {
+		if old.Name == sc.Name && old.Domain == sc.Domain && old.Path == sc.Path {
+			found = i
+			break
+		}
+	}
+
+	switch {
+	case found >= 0 && sc.Expired(now):
+		s.Cookies = append(s.Cookies[:found], s.Cookies[found+1:]...)
+	case found >= 0:
+		s.Cookies[found] = sc
+	case !sc.Expired(now):
+		s.Cookies = append(s.Cookies, sc)
+	}
+}
+
+// cookieCheck is the result of a cookie set by the server checked by the cookie jar.
+type cookieCheck struct {
+	*SessionCookie
+	// Rejected is the reason why the cookie jar rejected the cookie, empty for accepted.
+	Rejected string
+}
+
+// recordingJar is a http.CookieJar which records the cookies set by the server into the store,
+// and keeps the checking results for inspection.
+type recordingJar struct {
+	*cookiejar.Jar
+	store *CookieStore
+
+	checks []cookieCheck
+	lock   sync.Mutex
+}
+
+func (j *recordingJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.Jar.SetCookies(u, cookies)
+	checks := checkCookies(j.Jar, u, cookies)
+
+	for _, c := range checks {
+		if c.Rejected == "" {
+			j.store.setCookie(c.SessionCookie)
+		}
+	}
+
+	j.lock.Lock()
+	j.checks = append(j.checks, checks...)
+	j.lock.Unlock()
+}
+
+// takeChecks returns the cookie checks recorded since the last call.
+func (j *recordingJar) takeChecks() []cookieCheck {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	checks := j.checks
+	j.checks = nil
+	return checks
+}
+
+// checkCookies checks whether the cookies set by the server for the url u are accepted by the jar,
+// the cookies should be already set to the jar.
+func checkCookies(jar http.CookieJar, u *url.URL, cookies []*http.Cookie) []cookieCheck {
+	now := time.Now()
+	checks := make([]cookieCheck, 0, len(cookies))
+	for _, c := range cookies {
+		sc := newSessionCookie(u, c, now)
+		check := cookieCheck{SessionCookie: sc}
+		if !sc.Expired(now) && !jarHasCookie(jar, u, sc) {
+			check.Rejected = cookieRejectedReason(u, c)
+		}
+		checks = append(checks, check)
+	}
+
+	return checks
+}
+
+func jarHasCookie(jar http.CookieJar, u *url.URL, c *SessionCookie) bool {
+	cu := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: c.Path}
+	if c.Secure {
+		cu.Scheme = "https"
+	}
+	for _, jc := range jar.Cookies(cu) {
+		if jc.Name == c.Name && jc.Value == c.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// cookieRejectedReason guesses the reason why the cookie was rejected by the cookie jar.
+func cookieRejectedReason(u *url.URL, c *http.Cookie) string {
+	host := strings.ToLower(u.Hostname())
+	domain := strings.TrimPrefix(strings.ToLower(c.Domain), ".")
+	switch {
+	case domain == "":
+	case net.ParseIP(host) != nil && domain != host:
+		return "domain attribute on IP host"
+	case host != domain && !strings.HasSuffix(host, "."+domain):
+		return "domain mismatch"
+	case !strings.Contains(domain, ".") && domain != host:
+		return "domain is a top level domain"
+	}
+
+	return "rejected by cookie jar"
+}
+
+// newSessionCookie converts the cookie set by the server for the url u to the session cookie,
+// filling the defaults of domain, path and expiry by RFC 6265.
+func newSessionCookie(u *url.URL, c *http.Cookie, now time.Time) *SessionCookie {
+	sc := &SessionCookie{
+		Name: c.Name, Value: c.Value, Domain: strings.TrimPrefix(strings.ToLower(c.Domain), "."),
+		Path: c.Path, Secure: c.Secure, HttpOnly: c.HttpOnly, SameSite: sameSiteString(c.SameSite),
+	}
+
+	if sc.Domain == "" {
+		sc.Domain = u.Hostname()
+		sc.HostOnly = true
+	}
+
+	if sc.Path == "" || sc.Path[0] != '/' {
+		sc.Path = u.Path
+		if i := strings.LastIndex(sc.Path, "/"); i > 0 {
+			sc.Path = sc.Path[:i]
+		} else {
+			sc.Path = "/"
+		}
+	}
+
+	switch {
+	case c.MaxAge < 0:
+		sc.Expires = 1
+	case c.MaxAge > 0:
+		sc.Expires = now.Unix() + int64(c.MaxAge)
+	case !c.Expires.IsZero():
+		sc.Expires = c.Expires.Unix()
+	}
+
+	return sc
+}
+
+func sameSiteString(s http.SameSite) string {
+	switch s {
+	case http.SameSiteLaxMode:
+		return "Lax"
+	case http.SameSiteStrictMode:
+		return "Strict"
+	case http.SameSiteNoneMode:
+		return "None"
+	default:
+		return ""
+	}
+}
+
+const httpOnlyPrefix = "#HttpOnly_"
+
+// ReadNetscapeCookies reads cookies in the Netscape cookie file format, which is used by curl and browser exports.
+func ReadNetscapeCookies(r io.Reader) ([]*SessionCookie, error) {
+	var cookies []*SessionCookie
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		httpOnly := strings.HasPrefix(line, httpOnlyPrefix)
+		if httpOnly {
+			line = line[len(httpOnlyPrefix):]
+		} else if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("line %d: expected 7 tab separated fields, got %d", n, len(fields))
+		}
+
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad expires %q", n, fields[4])
+		}
+
+		cookies = append(cookies, &SessionCookie{
+			Domain:   strings.TrimPrefix(fields[0], "."),
+			HostOnly: !strings.EqualFold(fields[1], "TRUE"),
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			Expires:  expires,
+			Name:     fields[5],
+			Value:    fields[6],
+			HttpOnly: httpOnly,
+		})
+	}
+
+	return cookies, scanner.Err()
+}
+
+// WriteNetscapeCookies writes cookies in the Netscape cookie file format.
+func WriteNetscapeCookies(w io.Writer, cookies []*SessionCookie) error {
+	bw := bufio.NewWriter(w)
+	_, _ = bw.WriteString("# Netscape HTTP Cookie File\n# This file was generated by gurl! Edit at your own risk.\n\n")
+
+	tf := func(b bool) string {
+		if b {
+			return "TRUE"
+		}
+		return "FALSE"
+	}
+	for _, c := range cookies {
+		domain := c.Domain
+		if !c.HostOnly {
+			domain = "." + domain
+		}
+		if c.HttpOnly {
+			domain = httpOnlyPrefix + domain
+		}
+		_, _ = fmt.Fprintf(bw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			domain, tf(!c.HostOnly), c.Path, tf(c.Secure), c.Expires, c.Name, c.Value)
+	}
+
+	return bw.Flush()
+}
+
+// setupCookieJar loads cookies from the Netscape cookie file into the request's cookie jar,
+// the returned function should be called to write the cookies back after the request is done.
+func setupCookieJar(file string, r *Request) func() {
+	var cookies []*SessionCookie
+	if f, err := os.Open(file); err == nil {
+		cookies, err = ReadNetscapeCookies(f)
+		_ = f.Close()
+		if err != nil {
+			log.Fatalf("read cookie jar %s: %v", file, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		log.Fatalf("open cookie jar %s: %v", file, err)
+	}
+
+	// merge into the session cookies if a session is in use.
+	store := &CookieStore{}
+	if j, ok := r.Jar.(*recordingJar); ok {
+		store = j.store
+	}
+	for _, c := range cookies {
+		store.setCookie(c)
+	}
+	r.Jar = store.NewJar()
+
+	return func() {
+		store.RemoveExpired()
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			log.Printf("write cookie jar %s: %v", file, err)
+			return
+		}
+		defer f.Close()
+
+		store.lock.Lock()
+		defer store.lock.Unlock()
+		if err := WriteNetscapeCookies(f, store.Cookies); err != nil {
+			log.Printf("write cookie jar %s: %v", file, err)
+		}
+	}
+}
+
+// printCookies prints the cookies set by the server in the response, and flags the ones rejected by the cookie jar.
+func printCookies(req *Request, res *http.Response) {
+	var checks []cookieCheck
+	if j, ok := req.Jar.(*recordingJar); ok {
+		checks = j.takeChecks()
+	} else if res.Request != nil {
+		jar, _ := cookiejar.New(nil)
+		jar.SetCookies(res.Request.URL, res.Cookies())
+		checks = checkCookies(jar, res.Request.URL, res.Cookies())
+	}
+
+	if len(checks) == 0 {
+		return
+	}
+
+	yesNo := func(b bool) string {
+		if b {
+			return "Y"
+		}
+		return ""
+	}
+
+	now := time.Now()
+	tw := createTableWriter()
+	tw.AppendHeader(table.Row{"Name", "Value", "Domain", "Path", "Expires", "Secure", "HttpOnly", "SameSite", "Status"})
+	for _, c := range checks {
+		domain := c.Domain
+		if !c.HostOnly {
+			domain = "." + domain
+		}
+
+		expires := "Session"
+		switch {
+		case c.Expired(now):
+			expires = "Expired (deleted)"
+		case c.Expires != 0:
+			t := time.Unix(c.Expires, 0)
+			expires = fmt.Sprintf("%s (in %s)", t.Format(time.RFC3339), t.Sub(now).Round(time.Second))
+		}
+
+		status := Color("accepted", Green)
+		if c.Rejected != "" {
+			status = Color("REJECTED: "+c.Rejected, Red)
+		}
+
+		tw.AppendRow(table.Row{c.Name, c.Value, domain, c.Path, expires,
+			yesNo(c.Secure), yesNo(c.HttpOnly), c.SameSite, status})
+	}
+	tw.Render()
+	fmt.Println()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNetscapeCookies(t *testing.T) {
+	src := `# Netscape HTTP Cookie File
+.example.com	TRUE	/	TRUE	1792392907	pref	dark
+#HttpOnly_api.example.com	FALSE	/v1	FALSE	0	sid	abc123
+`
+	cookies, err := ReadNetscapeCookies(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*SessionCookie{
+		{Name: "pref", Value: "dark", Domain: "example.com", Path: "/", Expires: 1792392907, Secure: true},
+		{Name: "sid", Value: "abc123", Domain: "api.example.com", Path: "/v1", HostOnly: true, HttpOnly: true},
+	}
+	if !reflect.DeepEqual(cookies, want) {
+		t.Fatalf("got %+v, want %+v", cookies, want)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteNetscapeCookies(&buf, cookies); err != nil {
+		t.Fatal(err)
+	}
+	again, err := ReadNetscapeCookies(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again, want) {
+		t.Fatalf("round trip got %+v, want %+v", again, want)
+	}
+}
+
+func TestRecordingJarChecks(t *testing.T) {
+	store := &CookieStore{}
+	jar := store.NewJar()
+	u, _ := url.Parse("http://api.example.com/v1/login")
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "sid", Value: "abc"},
+		{Name: "other", Value: "x", Domain: "other.com"},
+		{Name: "secure", Value: "s", Secure: true},
+		{Name: "old", Value: "o", Expires: time.Now().Add(-time.Hour)},
+	})
+
+	got := map[string]string{}
+	for _, c := range jar.takeChecks() {
+		got[c.Name] = c.Rejected
+	}
+	// a Secure cookie set over http is accepted, but only sent back over https,
+	// an expired one is a deletion, not a rejection.
+	want := map[string]string{"sid": "", "other": "domain mismatch", "secure": "", "old": ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("checks %v, want %v", got, want)
+	}
+	if checks := jar.takeChecks(); len(checks) != 0 {
+		t.Errorf("checks are not taken: %v", checks)
+	}
+
+	var names []string
+	for _, c := range store.Cookies {
+		names = append(names, c.Name+"@"+c.Domain+c.Path)
+	}
+	if want := []string{"sid@api.example.com/v1", "secure@api.example.com/v1"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("stored %v, want %v", names, want)
+	}
+
+	if cookies := jar.Cookies(u); len(cookies) != 1 || cookies[0].Name != "sid" {
+		t.Errorf("cookies over http %v", cookies)
+	}
+	su, _ := url.Parse("https://api.example.com/v1/me")
+	if cookies := jar.Cookies(su); len(cookies) != 2 {
+		t.Errorf("cookies over https %v", cookies)
+	}
+}
+
+func TestCookieRejectedReason(t *testing.T) {
+	for _, c := range []struct {
+		url, domain, want string
+	}{
+		{"http://api.example.com/", "other.com", "domain mismatch"},
+		{"http://127.0.0.1/", "example.com", "domain attribute on IP host"},
+		{"http://api.example.com/", "com", "domain is a top level domain"},
+		{"http://api.example.com/", "", "rejected by cookie jar"},
+	} {
+		u, _ := url.Parse(c.url)
+		if got := cookieRejectedReason(u, &http.Cookie{Name: "a", Value: "b", Domain: c.domain}); got != c.want {
+			t.Errorf("%s with domain %q: %q, want %q", c.url, c.domain, got, c.want)
+		}
+	}
+}
@@ -92,7 +92,8 @@ func parseContentRange(contentRangeHead string) (*contentRange, error) {
 	}, nil
 }
 
-func downloadFile(req *Request, res *http.Response, filename string) {
+// downloadFile downloads the response body to the file, and copies it to the head writer too if not nil.
+func downloadFile(req *Request, res *http.Response, filename string, head io.Writer) {
 	if ext := filepath.Ext(filename); ext == "" {
 		contentType := res.Header.Get("Content-Type")
 		if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
@@ -155,7 +156,11 @@ func downloadFile(req *Request, res *http.Response, filename string) {
 		}
 	}
 
-	if _, err := io.Copy(fd, br); err != nil {
+	w := io.Writer(fd)
+	if head != nil {
+		w = io.MultiWriter(fd, head)
+	}
+	if _, err := io.Copy(w, br); err != nil {
 		// A successful Copy returns err == nil, not err == EOF.
 		log.Fatalf("download file %q failed: %v", filename, err)
 	}
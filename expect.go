@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bingoohuang/jj"
+)
+
+// Exit codes for the failed expectations, the first failed one decides the exit code of gurl.
+const (
+	ExitExpectStatus  = 10
+	ExitExpectHeader  = 11
+	ExitExpectJSON    = 12
+	ExitExpectBody    = 13
+	ExitExpectLatency = 14
+)
+
+// Expectation is a check on the response, like status=2xx, header:X-Id, json:data.id=1, body~ok, latency<500ms.
+type Expectation struct {
+	Spec   string
+	Kind   string // status, header, json, body or latency
+	Target string // header name or json path
+	Op     string // empty for existing, = for equals, ~ for regex matching, : for json type, < for latency
+	Value  string
+
+	re      *regexp.Regexp
+	latency time.Duration
+}
+
+// ExpectResult is the result of an expectation against a response.
+type ExpectResult struct {
+	*Expectation
+	Actual string
+	Failed bool
+}
+
+// ParseExpectation parses the expectation spec.
+func ParseExpectation(spec string) (*Expectation, error) {
+	e := &Expectation{Spec: spec}
+	kind, rest := spec, ""
+	if i := strings.IndexAny(spec, ":=~<"); i > 0 {
+		kind, rest = spec[:i], spec[i:]
+	}
+	e.Kind = kind
+
+	bad := func(format string) (*Expectation, error) {
+		return nil, fmt.Errorf("bad expect %q, should be like "+format, spec)
+	}
+
+	switch kind {
+	case "status":
+		if !strings.HasPrefix(rest, "=") || len(rest) == 1 {
+			return bad("status=200, status=2xx or status=200-299")
+		}
+		e.Op, e.Value = "=", rest[1:]
+	case "latency":
+		if !strings.HasPrefix(rest, "<") {
+			return bad("latency<500ms")
+		}
+		d, err := time.ParseDuration(rest[1:])
+		if err != nil {
+			return bad("latency<500ms")
+		}
+		e.Op, e.Value, e.latency = "<", rest[1:], d
+	case "body":
+		if !strings.HasPrefix(rest, "~") && !strings.HasPrefix(rest, "=") {
+			return bad("body~regex or body=text")
+		}
+		e.Op, e.Value = rest[:1], rest[1:]
+	case "header", "json":
+		if !strings.HasPrefix(rest, ":") || len(rest) == 1 {
+			return bad(kind + ":name, " + kind + ":name=value or " + kind + ":name~regex")
+		}
+		rest = rest[1:]
+		ops := "=~"
+		if kind == "json" {
+			ops = "=~:"
+		}
+		e.Target = rest
+		if i := strings.IndexAny(rest, ops); i > 0 {
+			e.Target, e.Op, e.Value = rest[:i], rest[i:i+1], rest[i+1:]
+		}
+		if kind == "json" {
+			e.Target = strings.TrimPrefix(strings.TrimPrefix(e.Target, "$"), ".")
+		}
+	default:
+		return bad("status=2xx, header:X-Id, json:data.id=1, body~ok or latency<500ms")
+	}
+
+	if e.Op == "~" {
+		re, err := regexp.Compile(e.Value)
+		if err != nil {
+			return nil, fmt.Errorf("bad expect regex %q: %w", e.Value, err)
+		}
+		e.re = re
+	}
+
+	return e, nil
+}
+
+// ExitCode returns the exit code when the expectation fails.
+func (e *Expectation) ExitCode() int {
+	switch e.Kind {
+	case "status":
+		return ExitExpectStatus
+	case "header":
+		return ExitExpectHeader
+	case "json":
+		return ExitExpectJSON
+	case "body":
+		return ExitExpectBody
+	default:
+		return ExitExpectLatency
+	}
+}
+
+// NeedsBody tells whether the expectation checks the response body.
+func (e *Expectation) NeedsBody() bool { return e.Kind == "body" || e.Kind == "json" }
+
+// Check checks the expectation against the response.
+func (e *Expectation) Check(res *http.Response, body []byte, latency time.Duration) ExpectResult {
+	r := ExpectResult{Expectation: e}
+	switch e.Kind {
+	case "status":
+		r.Actual = strconv.Itoa(res.StatusCode)
+		r.Failed = !matchStatus(e.Value, res.StatusCode)
+	case "latency":
+		r.Actual = latency.String()
+		r.Failed = latency >= e.latency
+	case "body":
+		r.Actual = string(body)
+		r.Failed = !e.match(r.Actual)
+	case "header":
+		values, ok := res.Header[http.CanonicalHeaderKey(e.Target)]
+		if !ok {
+			r.Actual, r.Failed = "(absent)", true
+			break
+		}
+		r.Actual = strings.Join(values, ", ")
+		r.Failed = e.Op != "" && !e.match(r.Actual)
+	case "json":
+		v := jj.GetBytes(body, e.Target)
+		if !v.Exists() {
+			r.Actual, r.Failed = "(absent)", true
+			break
+		}
+		switch e.Op {
+		case ":":
+			r.Actual = jsonType(v)
+			r.Failed = r.Actual != e.Value && !(e.Value == "boolean" && r.Actual == "bool")
+		case "=":
+			r.Actual = v.Raw
+			r.Failed = v.String() != e.Value && !jsonEqual(v.Raw, e.Value)
+		case "~":
+			r.Actual = v.String()
+			r.Failed = !e.match(r.Actual)
+		default:
+			r.Actual = v.Raw
+		}
+	}
+
+	return r
+}
+
+func (e *Expectation) match(actual string) bool {
+	if e.Op == "~" {
+		return e.re.MatchString(actual)
+	}
+	return actual == e.Value
+}
+
+// matchStatus tells whether the status code matches the expected, like 200, 2xx or 200-299.
+func matchStatus(expected string, code int) bool {
+	for _, exp := range strings.Split(expected, ",") {
+		exp = strings.TrimSpace(exp)
+		if from, to, ok := strings.Cut(exp, "-"); ok {
+			f, err1 := strconv.Atoi(from)
+			t, err2 := strconv.Atoi(to)
+			if err1 == nil && err2 == nil && code >= f && code <= t {
+				return true
+			}
+			continue
+		}
+
+		s := strconv.Itoa(code)
+		if len(exp) == len(s) {
+			matched := true
+			for i := range exp {
+				if c := exp[i]; c != 'x' && c != 'X' && c != s[i] {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func jsonType(v jj.Result) string {
+	switch {
+	case v.IsObject():
+		return "object"
+	case v.IsArray():
+		return "array"
+	case v.IsBool():
+		return "bool"
+	case v.Type == jj.Number:
+		return "number"
+	case v.Type == jj.String:
+		return "string"
+	default:
+		return "null"
+	}
+}
+
+// jsonEqual tells whether the two JSON texts are semantically equal.
+func jsonEqual(a, b string) bool {
+	var x, y interface{}
+	if json.Unmarshal([]byte(a), &x) != nil || json.Unmarshal([]byte(b), &y) != nil {
+		return false
+	}
+	xs, _ := json.Marshal(x)
+	ys, _ := json.Marshal(y)
+	return bytes.Equal(xs, ys)
+}
+
+var (
+	expectations []*Expectation
+	// expectExitCode is the exit code of the first failed expectation.
+	expectExitCode int
+)
+
+func setupExpectations(specs []string) {
+	for _, spec := range specs {
+		e, err := ParseExpectation(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		expectations = append(expectations, e)
+	}
+}
+
+// checkExpectations checks the response against the expectations, and prints the failed ones,
+// the body and json ones fail when the body is unavailable for the reason, like downloaded as binary.
+func checkExpectations(req *Request, res *http.Response, body []byte, unavailable string, latency time.Duration) {
+	failed := 0
+	for _, e := range expectations {
+		r := ExpectResult{Expectation: e, Actual: "(" + unavailable + ")", Failed: true}
+		if unavailable == "" || !e.NeedsBody() {
+			r = e.Check(res, body, latency)
+		}
+		if !r.Failed {
+			continue
+		}
+
+		failed++
+		if expectExitCode == 0 {
+			expectExitCode = e.ExitCode()
+		}
+		printExpectFailure(req, r)
+	}
+
+	if failed == 0 && len(expectations) > 0 && HasPrintOption(printVerbose) {
+		log.Printf("all %d expectations passed", len(expectations))
+	}
+}
+
+// Expected returns the readable expected value.
+func (r ExpectResult) Expected() string {
+	switch r.Op {
+	case "":
+		return "(present)"
+	case "=":
+		return r.Value
+	case ":":
+		return "type " + r.Value
+	default:
+		return r.Op + r.Value
+	}
+}
+
+// Abbr returns the actual value abbreviated to at most 512 bytes.
+func (r ExpectResult) Abbr() string {
+	if len(r.Actual) > 512 {
+		return r.Actual[:512] + "..."
+	}
+	return r.Actual
+}
+
+func printExpectFailure(req *Request, r ExpectResult) {
+	fmt.Fprintf(os.Stderr, "%s %s %s\n", Color("expect failed:", Red), Color(r.Spec, Yellow), Color(req.Req.URL.String(), Gray))
+	fmt.Fprintf(os.Stderr, "  %s %s\n", Color("- expected:", Green), r.Expected())
+	fmt.Fprintf(os.Stderr, "  %s %s\n", Color("+ actual:  ", Red), r.Abbr())
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestMatchStatus(t *testing.T) {
+	cases := []struct {
+		expected string
+		code     int
+		want     bool
+	}{
+		{"200", 200, true},
+		{"2xx", 204, true},
+		{"2xx", 301, false},
+		{"200-299", 250, true},
+		{"200-299", 404, false},
+		{"200,404", 404, true},
+	}
+	for _, c := range cases {
+		if got := matchStatus(c.expected, c.code); got != c.want {
+			t.Errorf("matchStatus(%q, %d) = %t, want %t", c.expected, c.code, got, c.want)
+		}
+	}
+}
+
+func TestParseExpectation(t *testing.T) {
+	cases := []struct {
+		spec                  string
+		kind, target, op, val string
+	}{
+		{"status=2xx", "status", "", "=", "2xx"},
+		{"header:X-Id", "header", "X-Id", "", ""},
+		{"header:Content-Type~json", "header", "Content-Type", "~", "json"},
+		{"json:$.data.id=1", "json", "data.id", "=", "1"},
+		{"json:data.url=http://a.cn", "json", "data.url", "=", "http://a.cn"},
+		{"json:data.tags:array", "json", "data.tags", ":", "array"},
+		{"body~ok", "body", "", "~", "ok"},
+		{"latency<500ms", "latency", "", "<", "500ms"},
+	}
+	for _, c := range cases {
+		e, err := ParseExpectation(c.spec)
+		if err != nil {
+			t.Fatalf("ParseExpectation(%q): %v", c.spec, err)
+		}
+		if e.Kind != c.kind || e.Target != c.target || e.Op != c.op || e.Value != c.val {
+			t.Errorf("ParseExpectation(%q) = %+v", c.spec, e)
+		}
+	}
+
+	for _, spec := range []string{"status", "latency<abc", "header:", "foo=1"} {
+		if _, err := ParseExpectation(spec); err == nil {
+			t.Errorf("ParseExpectation(%q) should fail", spec)
+		}
+	}
+}
+
+func TestDownloadExpectations(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write(bytes.Repeat([]byte{0xff}, 4096))
+	}))
+	defer ts.Close()
+
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	saved := expectations
+	defer func() { expectations, expectExitCode = saved, 0 }()
+	setupExpectations([]string{"status=200"})
+
+	req := NewRequest(ts.URL+"/data.bin", http.MethodGet)
+	req.SetupTransport()
+	doRequestInternal(req, req.Req.URL)
+
+	if expectExitCode != ExitExpectStatus {
+		t.Errorf("expectExitCode = %d, want %d", expectExitCode, ExitExpectStatus)
+	}
+	if fi, err := os.Stat("data.bin"); err != nil || fi.Size() != 4096 {
+		t.Errorf("downloaded data.bin: %v", err)
+	}
+
+	expectations, expectExitCode = nil, 0
+	setupExpectations([]string{"json:id=1"})
+	req = NewRequest(ts.URL+"/data2.bin", http.MethodGet)
+	req.SetupTransport()
+	doRequestInternal(req, req.Req.URL)
+	if expectExitCode != ExitExpectJSON {
+		t.Errorf("expectExitCode = %d, want %d for the binary download", expectExitCode, ExitExpectJSON)
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// exportFormats lists the supported -export formats.
+var exportFormats = []string{"curl", "httpie", "go", "python", "raw"}
+
+// exportRequest writes the fully built request r with its body as code in the specified format.
+func exportRequest(w io.Writer, format string, r *http.Request, body []byte, gzipped bool) error {
+	switch format {
+	case "curl":
+		return exportCurl(w, r, body, gzipped)
+	case "httpie":
+		return exportHttpie(w, r, body, gzipped)
+	case "go":
+		return exportGo(w, r, body, gzipped)
+	case "python":
+		return exportPython(w, r, body, gzipped)
+	case "raw":
+		return exportRaw(w, r, body, gzipped)
+	default:
+		return fmt.Errorf("unknown export format %q, should be one of %s", format, strings.Join(exportFormats, "|"))
+	}
+}
+
+// peekBody reads the request body and puts the read content back, so the request can still be sent.
+func (b *Request) peekBody() []byte {
+	if b.Req.Body == nil {
+		return nil
+	}
+
+	data, err := io.ReadAll(b.Req.Body)
+	if err != nil {
+		log.Fatalf("read request body failed: %v", err)
+	}
+	_ = b.Req.Body.Close()
+	b.Req.Body = io.NopCloser(bytes.NewReader(data))
+	return data
+}
+
+type exportHeader struct {
+	Key, Value string
+}
+
+// exportHeaders returns the request headers (including Host if set) in a stable order.
+func exportHeaders(r *http.Request) (headers []exportHeader) {
+	if r.Host != "" && r.Host != r.URL.Host {
+		headers = append(headers, exportHeader{Key: "Host", Value: r.Host})
+	}
+
+	keys := make([]string, 0, len(r.Header))
+	for k := range r.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		for _, v := range r.Header[k] {
+			headers = append(headers, exportHeader{Key: k, Value: v})
+		}
+	}
+	return headers
+}
+
+// shellQuote quotes s in single quotes for POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// isBinary tells whether the body can not be put in a shell or Python string literal as it is.
+func isBinary(body []byte) bool {
+	return !utf8.Valid(body) || bytes.IndexByte(body, 0) >= 0
+}
+
+// pipedBody returns the shell pipe prefix like printf '%s' 'body' | gzip -c | , which feeds the body from the stdin,
+// or empty when the body can be passed as the argument.
+func pipedBody(body []byte, gzipped bool) string {
+	if len(body) == 0 || !gzipped && !isBinary(body) {
+		return ""
+	}
+
+	prefix := "printf '%s' " + shellQuote(string(body))
+	if isBinary(body) {
+		var b strings.Builder
+		for _, c := range body {
+			switch {
+			case c == '%':
+				b.WriteString("%%")
+			case c == '\\':
+				b.WriteString(`\\`)
+			case c >= 0x20 && c < 0x7f && c != '\'':
+				b.WriteByte(c)
+			default:
+				fmt.Fprintf(&b, `\%03o`, c)
+			}
+		}
+		prefix = "printf '" + b.String() + "'"
+	}
+	if gzipped {
+		prefix += " | gzip -c"
+	}
+	return prefix + " | "
+}
+
+func exportCurl(w io.Writer, r *http.Request, body []byte, gzipped bool) error {
+	var lines []string
+	piped := pipedBody(body, gzipped)
+	lines = append(lines, piped+"curl -X "+r.Method+" "+shellQuote(r.URL.String()))
+
+	for _, h := range exportHeaders(r) {
+		lines = append(lines, "  -H "+shellQuote(h.Key+": "+h.Value))
+	}
+
+	if len(body) > 0 {
+		if piped != "" {
+			lines = append(lines, "  --data-binary @-")
+		} else {
+			lines = append(lines, "  --data-raw "+shellQuote(string(body)))
+		}
+	}
+
+	_, err := fmt.Fprintln(w, strings.Join(lines, " \\\n"))
+	return err
+}
+
+func exportHttpie(w io.Writer, r *http.Request, body []byte, gzipped bool) error {
+	var lines []string
+	piped := pipedBody(body, gzipped)
+	lines = append(lines, piped+"http "+r.Method+" "+shellQuote(r.URL.String()))
+
+	for _, h := range exportHeaders(r) {
+		lines = append(lines, "  "+shellQuote(h.Key+":"+h.Value))
+	}
+
+	if len(body) > 0 && piped == "" {
+		lines = append(lines, "  --raw "+shellQuote(string(body)))
+	}
+
+	_, err := fmt.Fprintln(w, strings.Join(lines, " \\\n"))
+	return err
+}
+
+func exportGo(w io.Writer, r *http.Request, body []byte, gzipped bool) error {
+	gzipped = gzipped && len(body) > 0
+	var b strings.Builder
+	imports := []string{"fmt", "io", "net/http"}
+	switch {
+	case gzipped:
+		imports = []string{"bytes", "compress/gzip", "fmt", "io", "net/http"}
+	case len(body) > 0:
+		imports = append(imports, "strings")
+	}
+
+	b.WriteString("package main\n\nimport (\n")
+	for _, i := range imports {
+		b.WriteString("\t" + strconv.Quote(i) + "\n")
+	}
+	b.WriteString(")\n\nfunc main() {\n")
+
+	bodyExpr := "nil"
+	if len(body) > 0 {
+		if gzipped {
+			b.WriteString("\tvar buf bytes.Buffer\n")
+			b.WriteString("\tzw := gzip.NewWriter(&buf)\n")
+			b.WriteString("\tzw.Write([]byte(" + goQuote(body) + "))\n")
+			b.WriteString("\tzw.Close()\n\n")
+			bodyExpr = "&buf"
+		} else {
+			bodyExpr = "strings.NewReader(" + goQuote(body) + ")"
+		}
+	}
+
+	fmt.Fprintf(&b, "\treq, err := http.NewRequest(%q, %q, %s)\n", r.Method, r.URL.String(), bodyExpr)
+	b.WriteString("\tif err != nil {\n\t\tpanic(err)\n\t}\n")
+	for _, h := range exportHeaders(r) {
+		if h.Key == "Host" {
+			fmt.Fprintf(&b, "\treq.Host = %q\n", h.Value)
+		} else {
+			fmt.Fprintf(&b, "\treq.Header.Add(%q, %q)\n", h.Key, h.Value)
+		}
+	}
+	b.WriteString("\n\trsp, err := http.DefaultClient.Do(req)\n")
+	b.WriteString("\tif err != nil {\n\t\tpanic(err)\n\t}\n")
+	b.WriteString("\tdefer rsp.Body.Close()\n\n")
+	b.WriteString("\tdata, _ := io.ReadAll(rsp.Body)\n")
+	b.WriteString("\tfmt.Println(rsp.Status)\n")
+	b.WriteString("\tfmt.Println(string(data))\n")
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// goQuote quotes data as a Go string literal, using a raw string literal when it is readable.
+func goQuote(data []byte) string {
+	s := string(data)
+	if utf8.ValidString(s) && !strings.ContainsAny(s, "`\r") {
+		return "`" + s + "`"
+	}
+	return strconv.Quote(s)
+}
+
+func exportPython(w io.Writer, r *http.Request, body []byte, gzipped bool) error {
+	gzipped = gzipped && len(body) > 0
+	var b strings.Builder
+	if gzipped {
+		b.WriteString("import gzip\n")
+	}
+	b.WriteString("import requests\n\n")
+	fmt.Fprintf(&b, "url = %s\n", pyQuote(r.URL.String()))
+	b.WriteString("headers = {\n")
+	for _, h := range exportHeaders(r) {
+		fmt.Fprintf(&b, "    %s: %s,\n", pyQuote(h.Key), pyQuote(h.Value))
+	}
+	b.WriteString("}\n")
+
+	dataArg := ""
+	if len(body) > 0 {
+		if isBinary(body) {
+			fmt.Fprintf(&b, "data = %s\n", pyBytes(body))
+		} else {
+			fmt.Fprintf(&b, "data = %s.encode(\"utf-8\")\n", pyQuote(string(body)))
+		}
+		if gzipped {
+			b.WriteString("data = gzip.compress(data)\n")
+		}
+		dataArg = ", data=data"
+	}
+
+	fmt.Fprintf(&b, "\nrsp = requests.request(%s, url, headers=headers%s)\n", pyQuote(r.Method), dataArg)
+	b.WriteString("print(rsp.status_code, rsp.reason)\n")
+	b.WriteString("print(rsp.text)\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// pyQuote quotes s as a Python string literal.
+func pyQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, c := range s {
+		switch c {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if c < 0x20 {
+				fmt.Fprintf(&b, `\x%02x`, c)
+			} else {
+				b.WriteRune(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// pyBytes quotes data as a Python bytes literal, with the non-printable and non-ASCII bytes escaped.
+func pyBytes(data []byte) string {
+	var b strings.Builder
+	b.WriteString(`b"`)
+	for _, c := range data {
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c >= 0x20 && c < 0x7f:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// exportRaw writes the request as on the wire, the body is compressed when gzipped, as the Content-Encoding says.
+func exportRaw(w io.Writer, r *http.Request, body []byte, gzipped bool) error {
+	if gzipped && len(body) > 0 {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, _ = zw.Write(body)
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s HTTP/1.1\r\n", r.Method, r.URL.RequestURI())
+	host := r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+	fmt.Fprintf(&b, "Host: %s\r\n", host)
+	for _, h := range exportHeaders(r) {
+		if h.Key != "Host" {
+			fmt.Fprintf(&b, "%s: %s\r\n", h.Key, h.Value)
+		}
+	}
+	if len(body) > 0 {
+		fmt.Fprintf(&b, "Content-Length: %d\r\n", len(body))
+	}
+	b.WriteString("\r\n")
+	b.Write(body)
+
+	_, err := fmt.Fprintln(w, b.String())
+	return err
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files")
+
+func TestExportRequest(t *testing.T) {
+	var multipartBody bytes.Buffer
+	mw := multipart.NewWriter(&multipartBody)
+	_ = mw.SetBoundary("gurl-boundary")
+	_ = mw.WriteField("name", "bob")
+	fw, _ := mw.CreateFormFile("file", "a.txt")
+	_, _ = fw.Write([]byte("it's a file\n"))
+	_ = mw.Close()
+
+	cases := []struct {
+		name, contentType string
+		body              []byte
+		gzipped           bool
+	}{
+		{"quote", "application/json", []byte("{\"a\": \"it's\",\n\"b\": \"x\\\"y\"}"), false},
+		{"gzip", "text/plain", []byte("hello 'gzip'\nbye"), true},
+		{"multipart", mw.FormDataContentType(), multipartBody.Bytes(), false},
+		{"binary", "application/octet-stream", []byte("\x89PNG\r\n\x00\xff'%\\\"\n"), false},
+	}
+
+	for _, c := range cases {
+		for _, format := range exportFormats {
+			r, _ := http.NewRequest(http.MethodPost, "http://a.b/x?q=1&name=o'neil", nil)
+			r.Header.Set("Content-Type", c.contentType)
+			r.Header.Set("X-Name", "it's me")
+			r.Host = "c.d"
+			if c.gzipped {
+				// set by SendOut before the export, the same as sent.
+				r.Header.Set("Content-Encoding", "gzip")
+			}
+
+			var out bytes.Buffer
+			if err := exportRequest(&out, format, r, c.body, c.gzipped); err != nil {
+				t.Fatalf("%s %s: %v", c.name, format, err)
+			}
+
+			golden := filepath.Join("testdata", "export", c.name+"."+format)
+			if *updateGolden {
+				_ = os.MkdirAll(filepath.Dir(golden), 0o755)
+				if err := os.WriteFile(golden, out.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				continue
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out.Bytes(), want) {
+				t.Errorf("%s %s:\n%s\nwant:\n%s", c.name, format, out.Bytes(), want)
+			}
+		}
+	}
+
+	if err := exportRequest(io.Discard, "wget", &http.Request{}, nil, false); err == nil {
+		t.Error("unknown format should fail")
+	}
+}
+
+func TestPeekBody(t *testing.T) {
+	req := NewRequest("http://a.b/x", http.MethodPost)
+	req.Body("hello")
+
+	for i := 0; i < 2; i++ {
+		if body := req.peekBody(); string(body) != "hello" {
+			t.Errorf("peekBody %d = %q", i, body)
+		}
+	}
+	if body, _ := io.ReadAll(req.Req.Body); string(body) != "hello" {
+		t.Errorf("body after peekBody = %q", body)
+	}
+
+	if body := NewRequest("http://a.b/x", http.MethodGet).peekBody(); body != nil {
+		t.Errorf("peekBody without body = %q", body)
+	}
+}
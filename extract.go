@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/bingoohuang/jj"
+)
+
+// Extractor extracts a value from the response and saves it as a named variable.
+type Extractor struct {
+	Name string
+	// Kind is one of json, header and regex.
+	Kind string
+	Expr string
+	re   *regexp.Regexp
+}
+
+// ParseExtractor parses the extractor spec like name=jsonpath, name=header:X-Token or name=regex:token=(\w+).
+func ParseExtractor(spec string) (*Extractor, error) {
+	name, expr, ok := strings.Cut(spec, "=")
+	if !ok || name == "" || expr == "" {
+		return nil, fmt.Errorf("bad extract %q, should be name=jsonpath, name=header:X-Token or name=regex:...", spec)
+	}
+
+	e := &Extractor{Name: name, Kind: "json", Expr: expr}
+	if kind, v, ok := strings.Cut(expr, ":"); ok {
+		switch kind {
+		case "json", "header", "regex":
+			e.Kind, e.Expr = kind, v
+		}
+	}
+
+	switch e.Kind {
+	case "json":
+		// accept JSONPath like $.data.token as well as the jj path data.token
+		e.Expr = strings.TrimPrefix(strings.TrimPrefix(e.Expr, "$"), ".")
+	case "regex":
+		re, err := regexp.Compile(e.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("bad extract regex %q: %w", e.Expr, err)
+		}
+		e.re = re
+	}
+
+	return e, nil
+}
+
+// Extract extracts the value from the response header and body.
+func (e *Extractor) Extract(header http.Header, body []byte) (string, bool) {
+	switch e.Kind {
+	case "header":
+		v, ok := header[http.CanonicalHeaderKey(e.Expr)]
+		if !ok || len(v) == 0 {
+			return "", false
+		}
+		return v[0], true
+	case "regex":
+		subs := e.re.FindSubmatch(body)
+		if subs == nil {
+			return "", false
+		}
+		if len(subs) > 1 {
+			return string(subs[1]), true
+		}
+		return string(subs[0]), true
+	default:
+		r := jj.GetBytes(body, e.Expr)
+		return r.String(), r.Exists()
+	}
+}
+
+var (
+	extractors []*Extractor
+	// extractedVars are the variables to be persisted in the extract file.
+	extractedVars = map[string]string{}
+)
+
+// setupExtractors parses the extractor specs, and loads the persisted variables from the extract file.
+func setupExtractors(specs []string, file string) {
+	for _, spec := range specs {
+		e, err := ParseExtractor(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		extractors = append(extractors, e)
+	}
+
+	if file == "" {
+		return
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return
+		}
+		log.Fatalf("read extract file %s: %v", file, err)
+	}
+
+	if err := json.Unmarshal(data, &extractedVars); err != nil {
+		log.Fatalf("parse extract file %s: %v", file, err)
+	}
+
+	for k, v := range extractedVars {
+		valuer.SetVar(k, v)
+	}
+}
+
+// extractValues extracts the values from the response into the variables, and persists them if required,
+// it fails when a json or regex extractor can not run for the reason the body is unavailable, like downloaded as binary.
+func extractValues(res *http.Response, body []byte, unavailable string) {
+	if len(extractors) == 0 {
+		return
+	}
+
+	for _, e := range extractors {
+		if unavailable != "" && e.Kind != "header" {
+			log.Fatalf("extract %s by %s:%s: %s", e.Name, e.Kind, e.Expr, unavailable)
+		}
+
+		v, ok := e.Extract(res.Header, body)
+		if !ok {
+			log.Printf("extract %s by %s:%s: not found", e.Name, e.Kind, e.Expr)
+			continue
+		}
+
+		if HasPrintOption(printVerbose) {
+			log.Printf("extract %s: %s", e.Name, v)
+		}
+
+		valuer.SetVar(e.Name, v)
+		extractedVars[e.Name] = v
+	}
+
+	if extractFile != "" {
+		data, _ := json.MarshalIndent(extractedVars, "", "  ")
+		if err := os.WriteFile(extractFile, data, 0o600); err != nil {
+			log.Printf("write extract file %s: %v", extractFile, err)
+		}
+	}
+}
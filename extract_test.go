@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractor(t *testing.T) {
+	header := http.Header{"X-Token": {"h1"}}
+	body := []byte(`{"data": {"token": "j1", "id": 7}} next=n1`)
+
+	for _, c := range []struct {
+		spec, want string
+		found      bool
+	}{
+		{"token=data.token", "j1", true},
+		{"token=$.data.token", "j1", true},
+		{"id=json:data.id", "7", true},
+		{"token=header:x-token", "h1", true},
+		{`next=regex:next=(\w+)`, "n1", true},
+		{`next=regex:next=\w+`, "next=n1", true},
+		{"token=data.missing", "", false},
+		{"token=header:X-Missing", "", false},
+		{`next=regex:prev=(\w+)`, "", false},
+	} {
+		e, err := ParseExtractor(c.spec)
+		if err != nil {
+			t.Fatalf("%s: %v", c.spec, err)
+		}
+		if got, found := e.Extract(header, body); got != c.want || found != c.found {
+			t.Errorf("%s: got %q %v, want %q %v", c.spec, got, found, c.want, c.found)
+		}
+	}
+
+	for _, spec := range []string{"token", "=data.token", "next=regex:("} {
+		if _, err := ParseExtractor(spec); err == nil {
+			t.Errorf("%s: error expected", spec)
+		}
+	}
+}
+
+func TestExtractValues(t *testing.T) {
+	oldExtractors, oldFile := extractors, extractFile
+	defer func() {
+		extractors, extractFile, extractedVars = oldExtractors, oldFile, map[string]string{}
+		delete(valuer.Vars, "token")
+		delete(valuer.Vars, "missing")
+	}()
+
+	extractFile = filepath.Join(t.TempDir(), "vars.json")
+	extractors = nil
+	for _, spec := range []string{"token=data.token", "missing=data.missing"} {
+		e, _ := ParseExtractor(spec)
+		extractors = append(extractors, e)
+	}
+
+	extractValues(&http.Response{Header: http.Header{}}, []byte(`{"data": {"token": "abc"}}`), "")
+
+	// the extracted variable is visible to the next request.
+	if got := ExpandVars("Bearer @token"); got != "Bearer abc" {
+		t.Errorf("expanded %q", got)
+	}
+	if _, ok := valuer.Vars["missing"]; ok {
+		t.Errorf("missing variable is set")
+	}
+
+	data, err := os.ReadFile(extractFile)
+	if err != nil || string(data) != "{\n  \"token\": \"abc\"\n}" {
+		t.Errorf("extract file %q, %v", data, err)
+	}
+}
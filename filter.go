@@ -26,7 +26,7 @@ func filter(args []string) []string {
 			continue
 		}
 
-		if ss.HasPrefix(arg, "http://", "https://") {
+		if ss.HasPrefix(arg, "http://", "https://", "http+unix://", "https+unix://") {
 			urls = append(urls, arg)
 			continue
 		}
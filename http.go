@@ -35,7 +35,7 @@ func getHTTP(method, url string, args []string, timeout time.Duration) (r *Reque
 	r.DisableKeepAlives = disableKeepAlive
 	r.Setting = defaultSetting
 	r.Setting.ConnectTimeout = timeout
-	r.DryRequest = strings.HasPrefix(url, DryRequestURL)
+	r.DryRequest = strings.HasPrefix(url, DryRequestURL) || exportFormat != ""
 	r.Timeout = timeout
 	r.Header("Accept-Encoding", "gzip, deflate")
 	if form || method == "GET" {
@@ -44,6 +44,7 @@ func getHTTP(method, url string, args []string, timeout time.Duration) (r *Reque
 		r.Header("Accept", "application/json")
 	}
 	r.Header("Gurl-Date", time.Now().UTC().Format(http.TimeFormat))
+	jsonmap := map[string]interface{}{}
 	// https://httpie.io/docs#request-items
 	// Item Type	Description
 	// HTTP Headers Name:Value	Arbitrary HTTP header, e.g. X-API-Token:123
@@ -88,10 +89,17 @@ func getHTTP(method, url string, args []string, timeout time.Duration) (r *Reque
 			if k == "Host" {
 				r.SetHost(val)
 			} else {
+				r.headerItems = append(r.headerItems, k)
 				if strings.EqualFold(k, "Accept") && strings.EqualFold(val, "JSON") {
 					r.Header("Accept", "application/json")
 				} else {
-					r.Header(k, val)
+					if strings.Contains(val, "@") {
+						if r.headerTemplates == nil {
+							r.headerTemplates = map[string]string{}
+						}
+						r.headerTemplates[k] = val
+					}
+					r.Header(k, ExpandVars(val))
 				}
 			}
 		case "@": // files
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/bingoohuang/gg/pkg/ss"
+	"golang.org/x/net/http2"
+)
+
+// setupHTTP2 enables HTTP/2 on the transport, -http2 negotiates h2 by ALPN and falls back to HTTP/1.1,
+// -h2c uses the cleartext HTTP/2 with the prior knowledge.
+func (b *Request) setupHTTP2(t *http.Transport) http.RoundTripper {
+	if h2cEnabled {
+		if b.Req.URL.Scheme == "https" {
+			log.Fatalf("-h2c is the cleartext HTTP/2, use -http2 for https")
+		}
+		b.SetProtocolVersion("HTTP/2.0")
+		return newH2CTransport(TimeoutDialer(b.Setting.ConnectTimeout, nil, b.Setting.UnixSocket))
+	}
+	if !http2Enabled {
+		return t
+	}
+
+	if t.TLSClientConfig != nil && len(t.TLSClientConfig.NextProtos) == 0 {
+		t.TLSClientConfig.NextProtos = []string{http2.NextProtoTLS, "http/1.1"}
+	}
+
+	h2t := &http2.Transport{StrictMaxConcurrentStreams: true}
+	t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{
+		http2.NextProtoTLS: func(authority string, c *tls.Conn) http.RoundTripper {
+			printH2Connection("h2 negotiated by ALPN", authority)
+			cc, err := h2t.NewClientConn(sniffH2Frames(c))
+			if err != nil {
+				return h2ErrRoundTripper{err: err}
+			}
+			return h2ClientConn{ClientConn: cc}
+		},
+	}
+	if benchC > 1 {
+		// the streams are multiplexed over the limited connections.
+		t.MaxConnsPerHost = h2Conns
+	}
+	return t
+}
+
+// h2ClientConn is the HTTP/2 connection upgraded by ALPN,
+// it tells the http.Transport to drop it and dial a new one when it can not take new requests, like after GOAWAY.
+type h2ClientConn struct {
+	*http2.ClientConn
+}
+
+func (c h2ClientConn) RoundTrip(r *http.Request) (*http.Response, error) {
+	if !c.CanTakeNewRequest() {
+		return nil, h2NoCachedConnError{}
+	}
+	return c.ClientConn.RoundTrip(r)
+}
+
+type h2NoCachedConnError struct{}
+
+func (h2NoCachedConnError) IsHTTP2NoCachedConnError() {}
+func (h2NoCachedConnError) Error() string             { return "http2: no cached connection was available" }
+
+// h2ErrRoundTripper makes the http.Transport fail the dial with the error.
+type h2ErrRoundTripper struct{ err error }
+
+func (r h2ErrRoundTripper) RoundTripErr() error                             { return r.err }
+func (r h2ErrRoundTripper) RoundTrip(*http.Request) (*http.Response, error) { return nil, r.err }
+
+// h2CTransport round-robins the requests over the h2c transports, each of which keeps one connection.
+type h2CTransport struct {
+	transports []*http2.Transport
+	next       atomic.Uint32
+}
+
+func newH2CTransport(dial DialContextFn) http.RoundTripper {
+	n := 1
+	if benchC > 1 && h2Conns > 1 {
+		n = h2Conns
+	}
+
+	t := &h2CTransport{}
+	for i := 0; i < n; i++ {
+		t.transports = append(t.transports, &http2.Transport{
+			AllowHTTP:                  true,
+			StrictMaxConcurrentStreams: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				conn, err := dial(ctx, network, addr)
+				if err != nil {
+					return nil, err
+				}
+				printH2Connection("h2c prior knowledge", addr)
+				return sniffH2Frames(conn), nil
+			},
+		})
+	}
+	return t
+}
+
+func (t *h2CTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return t.transports[int(t.next.Add(1))%len(t.transports)].RoundTrip(r)
+}
+
+func printH2Connection(how, addr string) {
+	if HasPrintOption(printRspOption) && benchC <= 1 {
+		fmt.Printf("option HTTP2.Connection: %s with %s\n", how, addr)
+	}
+}
+
+// sniffH2Frames wraps the connection to print the HTTP/2 settings, streams and GOAWAY frames by -po.
+func sniffH2Frames(c net.Conn) net.Conn {
+	if !HasPrintOption(printRspOption) || benchC > 1 {
+		return c
+	}
+
+	printf := func(format string, a ...interface{}) { fmt.Printf(format, a...) }
+	return &h2SniffConn{
+		Conn: c,
+		in:   &h2FrameSniffer{printf: printf},
+		out:  &h2FrameSniffer{sent: true, preface: len(http2.ClientPreface), printf: printf},
+	}
+}
+
+type h2SniffConn struct {
+	net.Conn
+	in, out *h2FrameSniffer
+}
+
+func (c *h2SniffConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.in.feed(p[:n])
+	return n, err
+}
+
+func (c *h2SniffConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.out.feed(p[:n])
+	return n, err
+}
+
+// h2FrameSniffer parses the frames of one direction, only the payloads of the interesting frames are buffered.
+type h2FrameSniffer struct {
+	sent    bool
+	preface int
+	skip    int
+	buf     []byte
+	printf  func(format string, a ...interface{})
+}
+
+const h2FrameHeaderLen = 9
+
+func (s *h2FrameSniffer) feed(p []byte) {
+	for len(p) > 0 {
+		if n := s.preface + s.skip; n > 0 {
+			if n > len(p) {
+				n = len(p)
+			}
+			if s.preface > 0 {
+				s.preface -= n
+			} else {
+				s.skip -= n
+			}
+			p = p[n:]
+			continue
+		}
+
+		need := h2FrameHeaderLen
+		if len(s.buf) >= h2FrameHeaderLen {
+			need += s.length()
+		}
+		n := need - len(s.buf)
+		if n > len(p) {
+			n = len(p)
+		}
+		s.buf, p = append(s.buf, p[:n]...), p[n:]
+		if len(s.buf) < h2FrameHeaderLen {
+			continue
+		}
+
+		switch http2.FrameType(s.buf[3]) {
+		case http2.FrameSettings, http2.FrameGoAway, http2.FrameRSTStream:
+			if len(s.buf) == h2FrameHeaderLen+s.length() {
+				s.frame(s.buf)
+				s.buf = s.buf[:0]
+			}
+		default:
+			s.skip = s.length()
+			s.frame(s.buf)
+			s.buf = s.buf[:0]
+		}
+	}
+}
+
+func (s *h2FrameSniffer) length() int {
+	return int(s.buf[0])<<16 | int(s.buf[1])<<8 | int(s.buf[2])
+}
+
+func (s *h2FrameSniffer) frame(f []byte) {
+	typ, flags := http2.FrameType(f[3]), http2.Flags(f[4])
+	streamID := binary.BigEndian.Uint32(f[5:9]) & (1<<31 - 1)
+	payload := f[h2FrameHeaderLen:]
+	peer := ss.If(s.sent, "Client", "Server")
+
+	switch typ {
+	case http2.FrameSettings:
+		if flags.Has(http2.FlagSettingsAck) {
+			return
+		}
+		var settings []string
+		for ; len(payload) >= 6; payload = payload[6:] {
+			id, val := http2.SettingID(binary.BigEndian.Uint16(payload)), binary.BigEndian.Uint32(payload[2:])
+			settings = append(settings, fmt.Sprintf("%s=%d", id, val))
+		}
+		s.printf("option HTTP2.%sSettings: %s\n", peer, strings.Join(settings, ", "))
+	case http2.FrameHeaders:
+		s.printf("option HTTP2.Stream: %d, HEADERS %s, END_STREAM %t\n",
+			streamID, ss.If(s.sent, "sent", "received"), flags.Has(http2.FlagHeadersEndStream))
+	case http2.FrameRSTStream:
+		if len(payload) >= 4 {
+			s.printf("option HTTP2.%sRstStream: %d, %s\n", peer, streamID, http2.ErrCode(binary.BigEndian.Uint32(payload)))
+		}
+	case http2.FrameGoAway:
+		if len(payload) >= 8 {
+			lastStreamID := binary.BigEndian.Uint32(payload) & (1<<31 - 1)
+			s.printf("option HTTP2.%sGoAway: last stream %d, %s\n", peer, lastStreamID, http2.ErrCode(binary.BigEndian.Uint32(payload[4:])))
+		}
+	}
+}
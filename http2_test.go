@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/http2"
+)
+
+func TestH2FrameSniffer(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString(http2.ClientPreface)
+	fr := http2.NewFramer(&buf, nil)
+	_ = fr.WriteSettings(http2.Setting{ID: http2.SettingEnablePush}, http2.Setting{ID: http2.SettingInitialWindowSize, Val: 65535})
+	_ = fr.WriteHeaders(http2.HeadersFrameParam{StreamID: 1, BlockFragment: []byte{0x82}, EndHeaders: true})
+	_ = fr.WriteData(1, true, bytes.Repeat([]byte("x"), 10000))
+	_ = fr.WriteSettingsAck()
+	_ = fr.WriteGoAway(1, http2.ErrCodeNo, nil)
+
+	var out strings.Builder
+	s := &h2FrameSniffer{sent: true, preface: len(http2.ClientPreface), printf: func(format string, a ...interface{}) {
+		fmt.Fprintf(&out, format, a...)
+	}}
+	for data := buf.Bytes(); len(data) > 0; {
+		n := 7
+		if n > len(data) {
+			n = len(data)
+		}
+		s.feed(data[:n])
+		data = data[n:]
+	}
+
+	want := "option HTTP2.ClientSettings: ENABLE_PUSH=0, INITIAL_WINDOW_SIZE=65535\n" +
+		"option HTTP2.Stream: 1, HEADERS sent, END_STREAM false\n" +
+		"option HTTP2.ClientGoAway: last stream 1, NO_ERROR\n"
+	if out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
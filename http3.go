@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// setupHTTP3 sends the requests over QUIC by -http3,
+// or by -alt-svc, switches from h1 to HTTP/3 for the later requests when the server advertises h3 by the Alt-Svc header.
+func (b *Request) setupHTTP3(t *http.Transport, h1 http.RoundTripper) http.RoundTripper {
+	if (http3Enabled || altSvcEnabled) && b.Setting.UnixSocket != "" {
+		// QUIC runs over UDP, it can not be sent over the unix domain socket.
+		log.Fatalf("-http3 and -alt-svc can not be used with the unix socket %s", b.Setting.UnixSocket)
+	}
+	if !http3Enabled && (!altSvcEnabled || b.Req.URL.Scheme != "https") {
+		return h1
+	}
+	if b.Req.URL.Scheme != "https" {
+		log.Fatalf("-http3 requires https")
+	}
+
+	if quic0RTT && tlsPins != "" {
+		// the 0-RTT request is sent before the server certificates can be checked against the pins.
+		log.Fatalf("-0rtt can not be used with -pin")
+	}
+
+	h3 := &h3Transport{b: b}
+	h3.rt = &http3.RoundTripper{TLSClientConfig: t.TLSClientConfig, QuicConfig: &quic.Config{}, Dial: h3.dial}
+	if !http3Enabled {
+		h3.h1 = h1
+	}
+	return h3
+}
+
+type h3Transport struct {
+	b  *Request
+	rt *http3.RoundTripper
+	h1 http.RoundTripper
+
+	// altSvc maps the host:port to the h3 authority advertised by Alt-Svc.
+	altSvc sync.Map
+
+	transportOnce sync.Once
+	transport     *quic.Transport
+	transportErr  error
+
+	// earlyConns are the 0-RTT connections, whose TLS state is printed after the handshake completes.
+	earlyConns sync.Map
+}
+
+func (t *h3Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if t.h1 != nil {
+		if _, ok := t.altSvc.Load(urlHostPort(r.URL)); !ok {
+			rsp, err := t.h1.RoundTrip(r)
+			if err == nil {
+				t.parseAltSvc(r, rsp.Header.Get("Alt-Svc"))
+			}
+			return rsp, err
+		}
+	}
+
+	if t.b.DisableKeepAlives {
+		t.rt.CloseIdleConnections()
+	}
+
+	if stat := t.b.stat; stat != nil {
+		// the DNS and handshake phases are zero when the QUIC connection is reused.
+		stat.t0 = time.Now()
+		stat.t1, stat.t3, stat.t5, stat.t6 = stat.t0, stat.t0, stat.t0, stat.t0
+	}
+
+	req := r
+	if quic0RTT && r.Method == http.MethodGet {
+		req = r.Clone(r.Context())
+		req.Method = http3.MethodGet0RTT
+	}
+	rsp, err := t.rt.RoundTrip(req)
+	if err != nil {
+		if t.h1 != nil {
+			// UDP may be blocked, go back to the TCP.
+			t.altSvc.Delete(urlHostPort(r.URL))
+			log.Printf("HTTP/3 by Alt-Svc failed: %v, fall back to TCP", err)
+			return t.h1.RoundTrip(r)
+		}
+		return nil, err
+	}
+
+	if trace := httptrace.ContextClientTrace(r.Context()); trace != nil && trace.GotFirstResponseByte != nil {
+		trace.GotFirstResponseByte()
+	}
+
+	t.earlyConns.Range(func(k, _ interface{}) bool {
+		t.earlyConns.Delete(k)
+		t.printConnState(k.(quic.EarlyConnection))
+		return true
+	})
+	return rsp, nil
+}
+
+// printConnState prints the TLS state of the QUIC connection, the -pin is checked in the handshake, see setupPins.
+func (t *h3Transport) printConnState(conn quic.EarlyConnection) {
+	<-conn.HandshakeComplete()
+	printTLSConnectState(conn.ConnectionState().TLS)
+}
+
+// parseAltSvc parses the Alt-Svc header like h3=":443"; ma=86400, h3-29=":443"; ma=86400.
+func (t *h3Transport) parseAltSvc(r *http.Request, altSvc string) {
+	for _, alt := range strings.Split(altSvc, ",") {
+		proto, value, ok := strings.Cut(strings.Split(alt, ";")[0], "=")
+		if !ok || strings.TrimSpace(proto) != "h3" {
+			continue
+		}
+
+		host, port, err := net.SplitHostPort(strings.Trim(strings.TrimSpace(value), `"`))
+		if err != nil {
+			continue
+		}
+		if host == "" {
+			host = r.URL.Hostname()
+		}
+
+		hostPort := urlHostPort(r.URL)
+		authority := net.JoinHostPort(host, port)
+		t.altSvc.Store(hostPort, authority)
+		if HasPrintOption(printRspOption) {
+			fmt.Printf("option Alt-Svc: %s, switch to HTTP/3 %s for %s\n", altSvc, authority, hostPort)
+		} else if HasPrintOption(printVerbose) {
+			log.Printf("Alt-Svc: %s, switch to HTTP/3 %s for %s", altSvc, authority, hostPort)
+		}
+		return
+	}
+}
+
+// dial dials the QUIC connection, with the DNS and handshake phases traced for the httpstat.
+func (t *h3Transport) dial(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
+	if a, ok := t.altSvc.Load(addr); ok {
+		addr = a.(string)
+	}
+
+	t.transportOnce.Do(func() {
+		var udpConn *net.UDPConn
+		if udpConn, t.transportErr = net.ListenUDP("udp", nil); t.transportErr == nil {
+			t.transport = &quic.Transport{Conn: udpConn}
+		}
+	})
+	if t.transportErr != nil {
+		return nil, t.transportErr
+	}
+
+	trace := httptrace.ContextClientTrace(ctx)
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if trace != nil && trace.DNSStart != nil {
+		trace.DNSStart(httptrace.DNSStartInfo{Host: host})
+	}
+	udpAddr, err := resolveUDPAddr(host, port)
+	if err != nil {
+		return nil, err
+	}
+	if trace != nil && trace.DNSDone != nil {
+		trace.DNSDone(httptrace.DNSDoneInfo{})
+	}
+
+	if trace != nil && trace.TLSHandshakeStart != nil {
+		trace.TLSHandshakeStart()
+	}
+	conn, err := t.transport.DialEarly(ctx, udpAddr, tlsCfg, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if quic0RTT {
+		// the request is sent before the handshake completes, the TLS state is printed after the response.
+		t.earlyConns.Store(conn, true)
+	} else {
+		select {
+		case <-conn.HandshakeComplete():
+		case <-ctx.Done():
+			conn.CloseWithError(0, "")
+			return nil, ctx.Err()
+		}
+		t.printConnState(conn)
+	}
+
+	if trace != nil && trace.TLSHandshakeDone != nil {
+		trace.TLSHandshakeDone(tls.ConnectionState{}, nil)
+	}
+	if trace != nil && trace.GotConn != nil {
+		trace.GotConn(httptrace.GotConnInfo{})
+	}
+	if stat := t.b.stat; stat != nil {
+		stat.quic = conn
+	}
+	return conn, nil
+}
+
+// resolveUDPAddr resolves the host by the -dns server if set.
+func resolveUDPAddr(host, port string) (*net.UDPAddr, error) {
+	if dns != "" && net.ParseIP(host) == nil {
+		dnsServer := dns
+		if _, _, err := net.SplitHostPort(dns); err != nil {
+			dnsServer = net.JoinHostPort(dns, "53")
+		}
+		ips, err := Resolve(host, dnsServer)
+		if err != nil {
+			return nil, err
+		}
+		if len(ips) > 0 {
+			host = ips[0]
+		}
+	}
+	return net.ResolveUDPAddr("udp", net.JoinHostPort(host, port))
+}
+
+func quicVersion(v quic.VersionNumber) string {
+	switch v {
+	case quic.Version1:
+		return "v1"
+	case quic.Version2:
+		return "v2"
+	default:
+		return v.String()
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseAltSvc(t *testing.T) {
+	for altSvc, want := range map[string]string{
+		`h3=":443"; ma=86400`:                      "a.b:443",
+		`h3-29=":8443", h3="alt.b:9443"; ma=86400`: "alt.b:9443",
+		`h2=":443"`: "",
+		`clear`:     "",
+	} {
+		r, _ := http.NewRequest("GET", "https://a.b/x", nil)
+		h3 := &h3Transport{}
+		h3.parseAltSvc(r, altSvc)
+
+		got := ""
+		if v, ok := h3.altSvc.Load("a.b:443"); ok {
+			got = v.(string)
+		}
+		if got != want {
+			t.Errorf("parseAltSvc(%s) = %q, want %q", altSvc, got, want)
+		}
+	}
+}
+
+func TestH3Transport(t *testing.T) {
+	c, err := serveTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewUnstartedServer(nil)
+	handler, err := serveHTTP3(ts.Listener.Addr().String(), c, http.HandlerFunc(serveEcho))
+	if err != nil {
+		t.Skip(err)
+	}
+	ts.Config.Handler, ts.TLS = handler, c
+	ts.StartTLS()
+	defer ts.Close()
+
+	savedAltSvc, savedHTTP3, savedPins := altSvcEnabled, http3Enabled, tlsPins
+	defer func() { altSvcEnabled, http3Enabled, tlsPins = savedAltSvc, savedHTTP3, savedPins }()
+
+	newTransport := func() http.RoundTripper {
+		req := NewRequest(ts.URL+"/x", http.MethodGet)
+		c := &tls.Config{InsecureSkipVerify: true}
+		setupPins(c)
+		req.SetTLSClientConfig(c)
+		req.SetupTransport()
+		return req.Transport
+	}
+	get := func(rt http.RoundTripper) (string, error) {
+		r, _ := http.NewRequest(http.MethodGet, ts.URL+"/x", nil)
+		rsp, err := rt.RoundTrip(r)
+		if err != nil {
+			return "", err
+		}
+		defer rsp.Body.Close()
+		var result EchoResult
+		if err := json.NewDecoder(rsp.Body).Decode(&result); err != nil {
+			return "", err
+		}
+		return rsp.Proto + " " + result.Proto, nil
+	}
+
+	// -alt-svc switches to HTTP/3 after the first h1 response advertises h3.
+	altSvcEnabled = true
+	rt := newTransport()
+	for i, want := range []string{"HTTP/1.1 HTTP/1.1", "HTTP/3.0 HTTP/3.0"} {
+		if got, err := get(rt); err != nil || got != want {
+			t.Errorf("request %d: %s %v, want %s", i, got, err, want)
+		}
+	}
+
+	// -http3 with a pin matching none of the server certificates.
+	altSvcEnabled, http3Enabled = false, true
+	tlsPins = "sha256//" + base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+	if _, err := get(newTransport()); err == nil || !strings.Contains(err.Error(), "pinning failed") {
+		t.Errorf("pin mismatch: %v", err)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPFileRequest is one request parsed from a .http file (VS Code REST Client / JetBrains HTTP client).
+type HTTPFileRequest struct {
+	Name    string
+	Method  string
+	URL     string
+	Headers []string // in the form of Key: Value
+	Body    string
+	// BodyFile is the file referenced by `< file`.
+	BodyFile string
+	// BodyFileEval tells whether the BodyFile should be interpolated, referenced by `<@ file`.
+	BodyFileEval bool
+}
+
+// HTTPFile is the parsed result of a .http file.
+type HTTPFile struct {
+	Vars     [][2]string
+	Requests []HTTPFileRequest
+}
+
+var (
+	httpFileVarReg     = regexp.MustCompile(`^@([\w.\-]+)\s*=\s*(.*)$`)
+	httpFileNameReg    = regexp.MustCompile(`^(?:#|//)\s*@name\s+(\S+)`)
+	httpFileRequestReg = regexp.MustCompile(`^([A-Z]+)\s+(\S+)(?:\s+HTTP/[\d.]+)?$`)
+	httpFileInterpReg  = regexp.MustCompile(`{{\s*(.+?)\s*}}`)
+)
+
+// ParseHTTPFile parses the content of a .http file, relative body files are resolved against dir.
+func ParseHTTPFile(data []byte, dir string) (*HTTPFile, error) {
+	f := &HTTPFile{}
+	var blocks [][]string
+	var block []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.HasPrefix(line, "###") {
+			blocks = append(blocks, block)
+			block = []string{line}
+			continue
+		}
+		block = append(block, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	blocks = append(blocks, block)
+
+	for _, b := range blocks {
+		r, err := f.parseBlock(b, dir)
+		if err != nil {
+			return nil, err
+		}
+		if r != nil {
+			if r.Name == "" {
+				r.Name = strconv.Itoa(len(f.Requests) + 1)
+			}
+			f.Requests = append(f.Requests, *r)
+		}
+	}
+
+	return f, nil
+}
+
+func (f *HTTPFile) parseBlock(lines []string, dir string) (*HTTPFileRequest, error) {
+	r := &HTTPFileRequest{}
+	i := 0
+
+	// preamble: separator, comments, @name and file variables until the request line.
+	for ; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		switch {
+		case strings.HasPrefix(line, "###"):
+			r.Name = strings.TrimSpace(strings.TrimLeft(line, "#"))
+			continue
+		case line == "":
+			continue
+		}
+
+		if subs := httpFileNameReg.FindStringSubmatch(line); len(subs) > 0 {
+			r.Name = subs[1]
+			continue
+		}
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
+			continue
+		}
+		if subs := httpFileVarReg.FindStringSubmatch(line); len(subs) > 0 {
+			f.Vars = append(f.Vars, [2]string{subs[1], strings.TrimSpace(subs[2])})
+			continue
+		}
+
+		if subs := httpFileRequestReg.FindStringSubmatch(line); len(subs) > 0 {
+			r.Method, r.URL = subs[1], subs[2]
+		} else if !strings.ContainsAny(line, " \t") {
+			r.Method, r.URL = "GET", line
+		} else {
+			return nil, fmt.Errorf("bad request line: %s", line)
+		}
+		i++
+		break
+	}
+
+	if r.URL == "" {
+		return nil, nil
+	}
+
+	// query continuation lines like `?a=b` or `&c=d`
+	for ; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(line, "?") && !strings.HasPrefix(line, "&") {
+			break
+		}
+		r.URL += line
+	}
+
+	// headers until the first blank line.
+	for ; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			i++
+			break
+		}
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
+			continue
+		}
+		if !strings.Contains(line, ":") {
+			return nil, fmt.Errorf("bad header line: %s", line)
+		}
+		r.Headers = append(r.Headers, line)
+	}
+
+	// body, response handlers (> {% ... %}) and redirections (>> file) are ignored.
+	var body []string
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "> {%"):
+			for i+1 < len(lines) && !strings.HasSuffix(strings.TrimSpace(lines[i]), "%}") {
+				i++
+			}
+			continue
+		case strings.HasPrefix(trimmed, ">>"):
+			continue
+		case len(body) == 0 && strings.HasPrefix(trimmed, "<@"):
+			r.BodyFile, r.BodyFileEval = strings.TrimSpace(trimmed[2:]), true
+			continue
+		case len(body) == 0 && strings.HasPrefix(trimmed, "< "):
+			r.BodyFile = strings.TrimSpace(trimmed[1:])
+			continue
+		}
+		body = append(body, line)
+	}
+
+	r.Body = strings.TrimSpace(strings.Join(body, "\n"))
+	if r.BodyFile != "" && !filepath.IsAbs(r.BodyFile) {
+		r.BodyFile = filepath.Join(dir, r.BodyFile)
+	}
+
+	return r, nil
+}
+
+// httpFileInterpolate converts the {{var}} interpolations to the @{var} form used by Eval.
+func httpFileInterpolate(s string) string {
+	return httpFileInterpReg.ReplaceAllStringFunc(s, func(m string) string {
+		name := httpFileInterpReg.FindStringSubmatch(m)[1]
+		if !strings.HasPrefix(name, "$") {
+			return "@{" + name + "}"
+		}
+
+		// REST Client system variables
+		fields := strings.Fields(name[1:])
+		switch fields[0] {
+		case "guid", "uuid":
+			return "@uuid"
+		case "timestamp":
+			return strconv.FormatInt(time.Now().Unix(), 10)
+		case "isoTimestamp":
+			return time.Now().UTC().Format(time.RFC3339)
+		case "processEnv", "dotenv":
+			if len(fields) > 1 {
+				return os.Getenv(strings.TrimPrefix(fields[1], "%"))
+			}
+			return ""
+		case "randomInt":
+			if len(fields) > 2 {
+				return "@random_int(" + fields[1] + "-" + fields[2] + ")"
+			}
+			return "@random_int"
+		default:
+			return "@" + fields[0]
+		}
+	})
+}
+
+// runHTTPFile runs the requests in the .http file, with an optional #name (or #index) to select only one.
+func runHTTPFile(httpFile string, nonFlagArgs []string) {
+	fn, name, _ := strings.Cut(httpFile, "#")
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		log.Fatalf("read http file %s: %v", fn, err)
+	}
+
+	f, err := ParseHTTPFile(data, filepath.Dir(fn))
+	if err != nil {
+		log.Fatalf("parse http file %s: %v", fn, err)
+	}
+
+	for _, kv := range f.Vars {
+		valuer.SetVar(kv[0], Eval(httpFileInterpolate(kv[1])))
+	}
+
+	requests := f.Requests
+	if name != "" {
+		requests = nil
+		var names []string
+		for i, r := range f.Requests {
+			if r.Name == name || strconv.Itoa(i+1) == name {
+				requests = append(requests, r)
+			}
+			names = append(names, r.Name)
+		}
+		if len(requests) == 0 {
+			log.Fatalf("request %s not found in %s, available: %s", name, fn, strings.Join(names, ", "))
+		}
+	}
+
+	for _, r := range requests {
+		if HasPrintOption(printVerbose) {
+			log.Printf("run request %s: %s %s", r.Name, r.Method, r.URL)
+		}
+
+		method = r.Method
+		methodSpecifiedInArgs = true
+		body = ""
+
+		switch {
+		case r.BodyFileEval:
+			content, err := os.ReadFile(r.BodyFile)
+			if err != nil {
+				log.Fatalf("read body file %s: %v", r.BodyFile, err)
+			}
+			body = httpFileInterpolate(string(content))
+		case r.BodyFile != "":
+			// the file is sent as is without the interpolation, so it is streamed rather than read into the memory.
+			if fi, err := os.Stat(r.BodyFile); err != nil {
+				log.Fatalf("read body file %s: %v", r.BodyFile, err)
+			} else if fi.IsDir() {
+				log.Fatalf("read body file %s: is a directory", r.BodyFile)
+			}
+			body = r.BodyFile
+		case r.Body != "":
+			body = httpFileInterpolate(r.Body)
+		}
+
+		args := make([]string, 0, len(r.Headers)+len(nonFlagArgs))
+		for _, h := range r.Headers {
+			k, v, _ := strings.Cut(h, ":")
+			args = append(args, strings.TrimSpace(k)+":"+Eval(httpFileInterpolate(strings.TrimSpace(v))))
+		}
+		args = append(args, nonFlagArgs...)
+
+		run(len(requests), httpFileInterpolate(r.URL), args, nil)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseHTTPFile(t *testing.T) {
+	src := `@host = localhost:8080
+@token = abc
+
+### list users
+GET http://{{host}}/users
+    ?page=1
+    &size=10
+Authorization: Bearer {{token}}
+
+###
+# @name create
+POST {{host}}/users HTTP/1.1
+Content-Type: application/json
+
+{"name": "{{$guid}}"}
+
+> {%
+    client.global.set("id", response.body.id);
+%}
+
+### upload
+PUT {{host}}/files
+Content-Type: application/octet-stream
+
+< ./data.bin
+`
+	f, err := ParseHTTPFile([]byte(src), "/tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := [][2]string{{"host", "localhost:8080"}, {"token", "abc"}}; !reflect.DeepEqual(f.Vars, want) {
+		t.Errorf("vars = %v, want %v", f.Vars, want)
+	}
+
+	want := []HTTPFileRequest{
+		{
+			Name: "list users", Method: "GET", URL: "http://{{host}}/users?page=1&size=10",
+			Headers: []string{"Authorization: Bearer {{token}}"},
+		},
+		{
+			Name: "create", Method: "POST", URL: "{{host}}/users",
+			Headers: []string{"Content-Type: application/json"},
+			Body:    `{"name": "{{$guid}}"}`,
+		},
+		{
+			Name: "upload", Method: "PUT", URL: "{{host}}/files",
+			Headers:  []string{"Content-Type: application/octet-stream"},
+			BodyFile: "/tmp/data.bin",
+		},
+	}
+	if !reflect.DeepEqual(f.Requests, want) {
+		t.Errorf("requests = %+v, want %+v", f.Requests, want)
+	}
+}
+
+func TestHTTPFileInterpolate(t *testing.T) {
+	if got := httpFileInterpolate(`{{host}}/x?id={{ $guid }}&n={{$randomInt 1 10}}`); got != "@{host}/x?id=@uuid&n=@random_int(1-10)" {
+		t.Errorf("got %s", got)
+	}
+}
@@ -74,10 +74,10 @@ func (b *Request) SetupTransport() {
 		}
 
 		if t.TLSClientConfig != nil && t.DialTLSContext == nil {
-			t.DialTLSContext = TimeoutDialer(b.Setting.ConnectTimeout, t.TLSClientConfig)
+			t.DialTLSContext = TimeoutDialer(b.Setting.ConnectTimeout, t.TLSClientConfig, b.Setting.UnixSocket)
 		}
 		if t.TLSClientConfig == nil && t.DialContext == nil {
-			t.DialContext = TimeoutDialer(b.Setting.ConnectTimeout, t.TLSClientConfig)
+			t.DialContext = TimeoutDialer(b.Setting.ConnectTimeout, t.TLSClientConfig, b.Setting.UnixSocket)
 		}
 	}
 
@@ -86,7 +86,10 @@ func (b *Request) SetupTransport() {
 		t.DisableKeepAlives = b.DisableKeepAlives
 	}
 	b.Req.Close = b.DisableKeepAlives
-	b.Transport = trans
+	if t, ok := trans.(*http.Transport); ok {
+		trans = b.setupHTTP3(t, b.setupHTTP2(t))
+	}
+	b.Transport = &dumpTransport{b: b, RoundTripper: trans}
 }
 
 // Settings .
@@ -99,6 +102,7 @@ type Settings struct {
 	DumpRequest    bool
 	EnableCookie   bool
 	DumpBody       bool
+	UnixSocket     string
 }
 
 // Request provides more useful methods for requesting one url than http.Request.
@@ -119,7 +123,17 @@ type Request struct {
 	url      string
 	ConnInfo httptrace.GotConnInfo
 
+	// Jar is the cookie jar shared by all the requests, like the one loaded from the session.
+	Jar http.CookieJar
+
+	// headerItems are the header names given in the request items.
+	headerItems []string
+	// headerTemplates are the header values referencing the named variables, which are expanded before each request.
+	headerTemplates map[string]string
+
 	rspBody, reqDump []byte
+	// dumpBody is the request body peeked for the dump and the export.
+	dumpBody []byte
 
 	urlQuery []string
 
@@ -420,6 +434,13 @@ func (b *Request) BuildURL() {
 	}
 }
 
+// ExpandHeaders expands the named variables referenced in the header values.
+func (b *Request) ExpandHeaders() {
+	for k, v := range b.headerTemplates {
+		b.Header(k, ExpandVars(v))
+	}
+}
+
 func (b *Request) Reset() {
 	b.resp.StatusCode = 0
 	b.rspBody = nil
@@ -468,6 +489,95 @@ func createParamBody(params map[string]string) string {
 	return paramBody
 }
 
+// RequestSigner signs the final request just before it is sent, like setting the signature headers.
+type RequestSigner interface {
+	Sign(r *http.Request) error
+}
+
+// SignTransport is a http.RoundTripper signing the requests by the Signer.
+type SignTransport struct {
+	Signer    RequestSigner
+	Transport http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *SignTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	if err := t.Signer.Sign(r); err != nil {
+		return nil, err
+	}
+
+	return t.Transport.RoundTrip(r)
+}
+
+// signedRequest returns the clone of the request with the body, signed by the signers of the transports,
+// to preview what would be sent after the auth by -export and the dump of the dry run.
+func (b *Request) signedRequest(body []byte) *http.Request {
+	r := b.Req.Clone(b.Req.Context())
+	if body != nil {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	if err := signRequest(r, b.Transport); err != nil {
+		log.Fatalf("sign request: %v", err)
+	}
+	return r
+}
+
+// dumpTransport is the innermost transport, which dumps the request as it is sent, after all the signers,
+// the last one wins when the request is retried, like by the Digest challenge or the OAuth2 token refresh.
+type dumpTransport struct {
+	b *Request
+	http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *dumpTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	// the redirected requests are not dumped, the same as before the signers.
+	if t.b.Setting.DumpRequest && r.URL.String() == t.b.Req.URL.String() {
+		t.b.dumpRequest(r)
+	}
+	return t.RoundTripper.RoundTrip(r)
+}
+
+// dumpRequest dumps the headers of r, with the body peeked before the gzip and the rate limit if it is dumped.
+func (b *Request) dumpRequest(r *http.Request) {
+	dumpBody := b.Setting.DumpBody && b.dumpBody != nil
+	if dumpBody {
+		r = r.Clone(r.Context())
+		r.Body = io.NopCloser(bytes.NewReader(b.dumpBody))
+	}
+
+	dump, err := httputil.DumpRequest(r, dumpBody)
+	if err != nil {
+		println(err.Error())
+	}
+	b.reqDump = dump
+}
+
+// signRequest signs the request by the signers of the transport chain, from the outermost to the innermost like sending.
+// The DigestTransport signs only by the challenge remembered from the previous response,
+// so the first request, sent before the server challenges, shows no Digest Authorization.
+func signRequest(r *http.Request, rt http.RoundTripper) error {
+	for {
+		var signer RequestSigner
+		switch t := rt.(type) {
+		case *SignTransport:
+			signer, rt = t.Signer, t.Transport
+		case *DigestTransport:
+			signer, rt = t, t.Transport
+		case *OAuth2Transport:
+			signer, rt = t, t.Transport
+		default:
+			return nil
+		}
+
+		if err := signer.Sign(r); err != nil {
+			return err
+		}
+	}
+}
+
 // LogRedirects log redirect
 // refer: Go HTTP Redirect的知识点总结 https://colobu.com/2017/04/19/go-http-redirect/
 type LogRedirects struct {
@@ -506,8 +616,8 @@ func (b *Request) SendOut() (*http.Response, error) {
 
 	b.Req.URL = u
 
-	var jar http.CookieJar
-	if b.Setting.EnableCookie {
+	jar := b.Jar
+	if jar == nil && b.Setting.EnableCookie {
 		jar, _ = cookiejar.New(nil)
 	}
 
@@ -527,16 +637,25 @@ func (b *Request) SendOut() (*http.Response, error) {
 		b.Header("Content-Encoding", "gzip")
 	}
 
-	if b.Setting.DumpRequest {
-		if useChunkedInRequest {
-			b.Req.TransferEncoding = []string{"chunked"}
-			b.Req.ContentLength = -1
-		}
-		dump, err := httputil.DumpRequest(b.Req, b.Setting.DumpBody)
-		if err != nil {
-			println(err.Error())
+	if b.Setting.DumpRequest && useChunkedInRequest {
+		b.Req.TransferEncoding = []string{"chunked"}
+		b.Req.ContentLength = -1
+	}
+
+	// the body is read into the memory only when it is dumped or exported, not for the large uploads like -F.
+	b.reqDump, b.dumpBody = nil, nil
+	if b.Setting.DumpRequest && b.Setting.DumpBody || exportFormat != "" {
+		b.dumpBody = b.peekBody()
+	}
+
+	if exportFormat != "" {
+		if err := exportRequest(os.Stdout, exportFormat, b.signedRequest(b.dumpBody), b.dumpBody, gzipOn); err != nil {
+			log.Fatalf("export request: %v", err)
 		}
-		b.reqDump = dump
+	}
+	if b.Setting.DumpRequest && b.DryRequest {
+		// nothing is sent, the dump shows the request signed for a preview.
+		b.dumpRequest(b.signedRequest(b.dumpBody))
 	}
 
 	if b.Req.Body != nil && gzipOn {
@@ -585,7 +704,7 @@ func (b *Request) String() (string, error) {
 // Bytes returns the body []byte in response.
 // it calls Response inner.
 func (b *Request) Bytes() ([]byte, error) {
-	if b.rspBody != nil {
+	if b.rspBody != nil || b.DryRequest {
 		return b.rspBody, nil
 	}
 	resp, err := b.Response()
@@ -669,10 +788,14 @@ func getLocalAddr() *net.TCPAddr {
 	return &net.TCPAddr{IP: ipAddr.IP}
 }
 
-var enableTLCP = env.Bool("TLCP", false)
+// TimeoutDialer returns functions of connection dialer with timeout settings for http.Transport Dial field,
+// it connects to the unixSocket instead if set, while the URL still supplies the Host and the path.
+func TimeoutDialer(cTimeout time.Duration, tlsConfig *tls.Config, unixSocket string) DialContextFn {
+	pins, err := parsePins(tlsPins)
+	if err != nil {
+		log.Fatalf("-pin: %v", err)
+	}
 
-// TimeoutDialer returns functions of connection dialer with timeout settings for http.Transport Dial field.
-func TimeoutDialer(cTimeout time.Duration, tlsConfig *tls.Config) DialContextFn {
 	return func(ctx context.Context, network, addr string) (net.Conn, error) {
 		dialer := &net.Dialer{
 			Timeout:   cTimeout,
@@ -680,9 +803,21 @@ func TimeoutDialer(cTimeout time.Duration, tlsConfig *tls.Config) DialContextFn
 			LocalAddr: getLocalAddr(),
 		}
 
+		tlsConfig := tlsConfig
+		if unixSocket != "" {
+			dialer.LocalAddr = nil
+			if tlsConfig != nil && tlsConfig.ServerName == "" {
+				tlsConfig = tlsConfig.Clone()
+				tlsConfig.ServerName, _, _ = net.SplitHostPort(addr)
+			}
+			network, addr = "unix", unixSocket
+		}
+
 		fn := dialer.DialContext
-		if enableTLCP {
+		if mode := tlcpModeOf(tlcpMode); mode == "on" {
 			fn = createTlcpDialer(dialer, caFile)
+		} else if tlsConfig != nil && mode == "auto" {
+			fn = createAutoTLSDialer(dialer, tlsConfig)
 		} else if tlsConfig != nil {
 			tlsDialer := &tls.Dialer{
 				NetDialer: dialer,
@@ -697,7 +832,7 @@ func TimeoutDialer(cTimeout time.Duration, tlsConfig *tls.Config) DialContextFn
 			dnsPort = "53"
 		}
 
-		if dnsIP != "" {
+		if dnsIP != "" && unixSocket == "" {
 			addrHost, addrPort, err := net.SplitHostPort(addr)
 			if err != nil {
 				addrHost = addr
@@ -729,10 +864,17 @@ func TimeoutDialer(cTimeout time.Duration, tlsConfig *tls.Config) DialContextFn
 			ConnectionState() tls.ConnectionState
 		}
 
+		// the TLS pins are checked in the handshake by the VerifyConnection of the config, see setupPins.
 		if cs, ok := conn.(tlsConnectionStater); ok {
 			printTLSConnectState(cs.ConnectionState())
 		} else if cs, ok := conn.(tlcpConnectionStater); ok {
-			printTLCPConnectState(cs.ConnectionState())
+			state := cs.ConnectionState()
+			printTLCPConnectState(state)
+			err = checkPins(pins, state.PeerCertificates)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
 		}
 
 		return conn, nil
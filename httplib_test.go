@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTimeoutDialerUnixSocket(t *testing.T) {
+	socket, fixedURL := parseUnixSocketURL("http+unix://%2Fvar%2Frun%2Fdocker.sock/v1.41/info?a=1")
+	if socket != "/var/run/docker.sock" || fixedURL != "http://localhost/v1.41/info?a=1" {
+		t.Errorf("parseUnixSocketURL = %s %s", socket, fixedURL)
+	}
+	if socket, fixedURL := parseUnixSocketURL("http://a.b/c"); socket != "" || fixedURL != "http://a.b/c" {
+		t.Errorf("parseUnixSocketURL = %s %s", socket, fixedURL)
+	}
+
+	socket = filepath.Join(t.TempDir(), "gurl.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skip(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Host+r.URL.Path)
+	})}
+	go server.Serve(ln)
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{DialContext: TimeoutDialer(0, nil, socket)}}
+	rsp, err := client.Get("http://docker/info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+
+	if body, _ := io.ReadAll(rsp.Body); string(body) != "docker/info" {
+		t.Errorf("got %s", body)
+	}
+}
+
+type bodySigner struct{ header string }
+
+func (s bodySigner) Sign(r *http.Request) error {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.Header.Set(s.header, fmt.Sprintf("%d:%s", len(body), r.Header.Get("X-Outer")))
+	return nil
+}
+
+func TestSignedRequestDump(t *testing.T) {
+	req := NewRequest("http://a.b/c", http.MethodPost)
+	req.Body("hello")
+	req.DryRequest = true
+	req.Setting.DumpRequest, req.Setting.DumpBody = true, true
+	digest := &DigestTransport{User: "u", Password: "p", Transport: &SignTransport{Signer: bodySigner{header: "X-Inner"}}}
+	req.Transport = &SignTransport{Signer: bodySigner{header: "X-Outer"}, Transport: digest}
+
+	if _, err := req.SendOut(); err != nil {
+		t.Fatal(err)
+	}
+	dump := string(req.reqDump)
+	for _, want := range []string{"X-Outer: 5:\r\n", "X-Inner: 5:5:\r\n", "\r\n\r\nhello"} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("dump %q should contain %q", dump, want)
+		}
+	}
+	if strings.Contains(dump, "Authorization") {
+		t.Errorf("dump %q should not contain the Digest Authorization before the challenge", dump)
+	}
+	if body, _ := io.ReadAll(req.Req.Body); string(body) != "hello" {
+		t.Errorf("request body %q should be kept", body)
+	}
+
+	digest.challenge = &digestChallenge{Realm: "r", Nonce: "n", Algorithm: "MD5", Qop: "auth"}
+	req.Body("hello")
+	if _, err := req.SendOut(); err != nil {
+		t.Fatal(err)
+	}
+	if dump := string(req.reqDump); !strings.Contains(dump, `Authorization: Digest username="u", realm="r", nonce="n", uri="/c"`) {
+		t.Errorf("dump %q should contain the Digest Authorization by the remembered challenge", dump)
+	}
+}
+
+// nonceSigner signs every request with a new nonce, like the JWT, HMAC and AWS signers.
+type nonceSigner struct{ n *int }
+
+func (s nonceSigner) Sign(r *http.Request) error {
+	*s.n++
+	r.Header.Set("X-Nonce", fmt.Sprintf("n%d", *s.n))
+	return nil
+}
+
+func TestDumpSentRequest(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Nonce", r.Header.Get("X-Nonce"))
+	}))
+	defer ts.Close()
+
+	for _, dumpBody := range []bool{true, false} {
+		req := NewRequest(ts.URL+"/c", http.MethodPost)
+		req.Body("hello")
+		req.Setting.DumpRequest, req.Setting.DumpBody = true, dumpBody
+		req.SetupTransport()
+		req.Transport = &SignTransport{Signer: nonceSigner{n: new(int)}, Transport: req.Transport}
+
+		rsp, err := req.SendOut()
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsp.Body.Close()
+
+		// the dump shows the nonce actually sent, not the one of a separate signing.
+		dump := string(req.reqDump)
+		if want := "X-Nonce: " + rsp.Header.Get("X-Nonce") + "\r\n"; rsp.Header.Get("X-Nonce") != "n1" || !strings.Contains(dump, want) {
+			t.Errorf("dump %q should contain %q", dump, want)
+		}
+		if got := strings.HasSuffix(dump, "\r\n\r\nhello"); got != dumpBody {
+			t.Errorf("dump %q with the body %t", dump, dumpBody)
+		}
+		if !dumpBody && req.dumpBody != nil {
+			t.Errorf("body is peeked without being dumped")
+		}
+	}
+}
@@ -9,7 +9,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/bingoohuang/gg/pkg/ss"
 	"github.com/fatih/color"
+	"github.com/quic-go/quic-go"
 )
 
 // some code is copy from https://github.com/davecheney/httpstat.
@@ -26,6 +28,8 @@ type httpStat struct {
 	t0, t1, t2, t3, t4, t5, t6 time.Time
 	t7                         time.Time // after read body
 	t31                        time.Time // WroteRequest
+
+	quic quic.EarlyConnection // the QUIC connection of HTTP/3
 }
 
 func createClientTrace(req *Request) *httptrace.ClientTrace {
@@ -76,7 +80,24 @@ func (stat *httpStat) print(urlSchema string) {
 		return strings.Join(v, "\n")
 	}
 
+	if stat.quic != nil {
+		urlSchema = "quic"
+	}
+
 	switch urlSchema {
+	case "quic":
+		printf(colorize(quicTemplate),
+			fa(stat.t1, stat.t0), // dns lookup
+			fa(stat.t6, stat.t5), // quic handshake
+			fa(stat.t4, stat.t3), // server processing
+			fa(stat.t7, stat.t4), // response transfer
+			fb(stat.t1, stat.t0), // namelookup
+			fb(stat.t3, stat.t0), // connect
+			fb(stat.t4, stat.t0), // starttransfer
+			fb(stat.t7, stat.t0), // total
+		)
+		state := stat.quic.ConnectionState()
+		printf("\nQUIC %s, 0-RTT: %s\n", quicVersion(state.Version), color.CyanString(ss.If(state.Used0RTT, "used", "not used")))
 	case "https":
 		printf(colorize(httpsTemplate),
 			fa(stat.t1, stat.t0),  // dns lookup
@@ -122,6 +143,15 @@ const (
 		`                                                                     starttransfer: %s          |` + "\n" +
 		`                                                                                                total: %s` + "\n"
 
+	quicTemplate = `` +
+		`  DNS Lookup   QUIC Handshake   Server Processing   Response Transfer` + "\n" +
+		`[%s  |    %s  |       %s  |      %s  ]` + "\n" +
+		`             |                |                   |                  |` + "\n" +
+		` namelookup: %s        |                   |                  |` + "\n" +
+		`                     connect: %s           |                  |` + "\n" +
+		`                                     starttransfer: %s        |` + "\n" +
+		`                                                                total: %s` + "\n"
+
 	httpTemplate = `` +
 		`   DNS Lookup   TCP Connection   Request Transfer   Server Processing   Response Transfer` + "\n" +
 		`[ %s  |    %s  |      %s  |      %s  |       %s  ]` + "\n" +
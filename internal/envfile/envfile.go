@@ -0,0 +1,120 @@
+// Package envfile loads the .env files on import, with the environment profile selected by -env name or $GURL_ENV.
+//
+// The files are layered, the former takes precedence over the latter:
+//  1. the process environment variables
+//  2. .env.{name} in the current directory
+//  3. {name}.env in the per-user profile directory, $GURL_PROFILES or {UserConfigDir}/gurl/profiles
+//  4. .env in the current directory
+//
+// Only the keys with the VarPrefix are exposed as the interpolation variables, by the name without the prefix.
+//
+// It must be imported before anything reading the environment variables, like the package level variables of gurl.
+package envfile
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+var (
+	// Name is the selected environment profile name.
+	Name string
+	// Files are the env files loaded, in precedence order.
+	Files []string
+	// Vars are the variables declared with the VarPrefix in the loaded env files, keyed without the prefix,
+	// with the values after layering. gurl's own config keys, like AUTH, are not variables.
+	Vars = map[string]string{}
+)
+
+// VarPrefix is the prefix of the keys declaring the variables, like VAR_host=127.0.0.1:5003 for @host.
+const VarPrefix = "VAR_"
+
+func init() {
+	Name = profileName(os.Args[1:])
+	if err := load(Name); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// load loads the env files of the profile name into the process environment, and collects the Files and Vars.
+func load(name string) error {
+	var files []string
+	if name != "" {
+		files = append(files, ".env."+name)
+		if dir := ProfileDir(); dir != "" {
+			files = append(files, filepath.Join(dir, name+".env"))
+		}
+	}
+	files = append(files, ".env")
+
+	Files, Vars = nil, map[string]string{}
+	for _, f := range files {
+		m, err := godotenv.Read(f)
+		if err != nil {
+			continue
+		}
+
+		Files = append(Files, f)
+		for k := range m {
+			if name := strings.TrimPrefix(k, VarPrefix); name != k && name != "" {
+				Vars[name] = ""
+			}
+		}
+		// godotenv.Load never overrides the variables which already exist.
+		_ = godotenv.Load(f)
+	}
+
+	if name != "" && (len(Files) == 0 || Files[0] == ".env") {
+		return fmt.Errorf("env profile %s not found, tried: %s", name, strings.Join(files[:len(files)-1], ", "))
+	}
+
+	for k := range Vars {
+		Vars[k] = os.Getenv(VarPrefix + k)
+	}
+	return nil
+}
+
+// ProfileDir returns the per-user profile directory.
+func ProfileDir() string {
+	if dir := os.Getenv("GURL_PROFILES"); dir != "" {
+		return dir
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "gurl", "profiles")
+}
+
+// profileName finds the profile name from the -env flag in the args, or $GURL_ENV in the environment or the .env file.
+func profileName(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+
+		name := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+		if name == arg {
+			continue
+		}
+		if name == "env" && i+1 < len(args) {
+			return args[i+1]
+		}
+		if v, ok := strings.CutPrefix(name, "env="); ok {
+			return v
+		}
+	}
+
+	if name := os.Getenv("GURL_ENV"); name != "" {
+		return name
+	}
+
+	m, _ := godotenv.Read(".env")
+	return m["GURL_ENV"]
+}
@@ -0,0 +1,73 @@
+package envfile
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	dir, profiles := t.TempDir(), t.TempDir()
+	write := func(file, content string) {
+		if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(dir, ".env.staging"), "GURL_T_A=name\nGURL_T_D=name\nVAR_GURL_T_F=name\n")
+	write(filepath.Join(profiles, "staging.env"), "GURL_T_A=profile\nGURL_T_B=profile\n")
+	write(filepath.Join(dir, ".env"), "GURL_T_A=dot\nGURL_T_B=dot\nGURL_T_C=dot\nVAR_GURL_T_E=dot\n")
+
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	t.Setenv("GURL_PROFILES", profiles)
+	for _, k := range []string{"GURL_T_A", "GURL_T_B", "GURL_T_C", "VAR_GURL_T_E", "VAR_GURL_T_F"} {
+		t.Setenv(k, "")
+		os.Unsetenv(k)
+	}
+	// the real environment variables win over the env files.
+	t.Setenv("GURL_T_D", "real")
+
+	if err := load("staging"); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{".env.staging", filepath.Join(profiles, "staging.env"), ".env"}; !reflect.DeepEqual(Files, want) {
+		t.Errorf("files %v, want %v", Files, want)
+	}
+	// only the keys with the VarPrefix are variables, the other keys are only in the environment.
+	if want := map[string]string{"GURL_T_E": "dot", "GURL_T_F": "name"}; !reflect.DeepEqual(Vars, want) {
+		t.Errorf("vars %v, want %v", Vars, want)
+	}
+	want := map[string]string{"GURL_T_A": "name", "GURL_T_B": "profile", "GURL_T_C": "dot", "GURL_T_D": "real", "VAR_GURL_T_E": "dot"}
+	for k, v := range want {
+		if got := os.Getenv(k); got != v {
+			t.Errorf("env %s=%q, want %q", k, got, v)
+		}
+	}
+
+	if err := load("prod"); err == nil || !strings.Contains(err.Error(), "env profile prod not found") {
+		t.Errorf("missing profile: %v", err)
+	}
+}
+
+func TestProfileName(t *testing.T) {
+	t.Setenv("GURL_ENV", "")
+	for _, c := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-env", "dev", ":8080"}, "dev"},
+		{[]string{"--env=prod"}, "prod"},
+		{[]string{"--", "-env", "dev"}, ""},
+	} {
+		if got := profileName(c.args); got != c.want {
+			t.Errorf("%v: %q, want %q", c.args, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/emmansun/gmsm/sm2"
+	"github.com/emmansun/gmsm/smx509"
+)
+
+var jwtAlgs = []string{"HS256", "RS256", "ES256", "SM2-SM3"}
+
+// JWTSigner mints a fresh JWT from the claims template for every request, and sets it into the header.
+type JWTSigner struct {
+	// Alg is one of HS256, RS256, ES256 and SM2-SM3.
+	Alg string
+	// Key is []byte for HS256, *rsa.PrivateKey for RS256, *ecdsa.PrivateKey for ES256 and *sm2.PrivateKey for SM2-SM3.
+	Key interface{}
+	// Claims is the JSON claims template, evaluated with the variables like @now and @uuid for every token.
+	Claims string
+	// Header is the header to set, Authorization gets the Bearer prefix.
+	Header string
+	Kid    string
+	// TTL is used to add iat and exp claims when they are absent, 0 to not add.
+	TTL time.Duration
+}
+
+// wrapJWTTransport wraps the request transport to send a freshly minted JWT in every request.
+func wrapJWTTransport(req *Request) {
+	if jwtClaims == "" {
+		return
+	}
+
+	claims := jwtClaims
+	if strings.HasPrefix(claims, "@") {
+		data, err := os.ReadFile(claims[1:])
+		if err != nil {
+			log.Fatalf("read jwt claims file %s: %v", claims[1:], err)
+		}
+		claims = string(data)
+	}
+
+	alg, key, err := loadJWTKey(jwtKey, jwtAlg)
+	if err != nil {
+		log.Fatalf("jwt: %v", err)
+	}
+
+	s := &JWTSigner{Alg: alg, Key: key, Claims: claims, Header: jwtHeader, Kid: jwtKid, TTL: jwtTTL}
+	if _, err := s.Mint(); err != nil {
+		log.Fatalf("jwt: %v", err)
+	}
+	req.Transport = &SignTransport{Signer: s, Transport: req.Transport}
+}
+
+// loadJWTKey loads the key by the spec, a PEM key file or @file, $ENV, or the literal HMAC secret like secret:xxx,
+// the alg is inferred from the key type when empty.
+func loadJWTKey(spec, alg string) (string, interface{}, error) {
+	alg = strings.ToUpper(alg)
+	if alg != "" && !inSlice(alg, jwtAlgs) {
+		return "", nil, fmt.Errorf("unknown alg %s, should be one of %s", alg, strings.Join(jwtAlgs, "|"))
+	}
+	if spec == "" {
+		return "", nil, errors.New("-jwt-key is required")
+	}
+
+	// the literal secret is opt-in, a typo in the key file name should never sign by the file name.
+	var data []byte
+	if secret, ok := strings.CutPrefix(spec, "secret:"); ok {
+		data = []byte(secret)
+	} else if strings.HasPrefix(spec, "$") {
+		data = []byte(readCredentials(spec))
+	} else {
+		d, err := os.ReadFile(strings.TrimPrefix(spec, "@"))
+		if err != nil {
+			return "", nil, fmt.Errorf("read -jwt-key: %w", err)
+		}
+		data = d
+	}
+	if len(data) == 0 {
+		return "", nil, fmt.Errorf("-jwt-key %s is empty", spec)
+	}
+
+	var key interface{} = data
+	if block, _ := pem.Decode(data); block != nil {
+		var err error
+		if key, err = parsePrivateKey(block); err != nil {
+			return "", nil, err
+		}
+	}
+
+	var keyAlg string
+	switch k := key.(type) {
+	case []byte:
+		keyAlg = "HS256"
+	case *rsa.PrivateKey:
+		keyAlg = "RS256"
+	case *sm2.PrivateKey:
+		keyAlg = "SM2-SM3"
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return "", nil, fmt.Errorf("ES256 requires P-256 key, got %s", k.Curve.Params().Name)
+		}
+		keyAlg = "ES256"
+	default:
+		return "", nil, fmt.Errorf("unsupported key type %T", key)
+	}
+
+	if alg == "" {
+		alg = keyAlg
+	} else if alg != keyAlg {
+		return "", nil, fmt.Errorf("alg %s does not match the key, which is for %s", alg, keyAlg)
+	}
+
+	return alg, key, nil
+}
+
+// parsePrivateKey parses the PKCS#1, PKCS#8 or SEC 1 private key, SM2 ones included.
+func parsePrivateKey(block *pem.Block) (interface{}, error) {
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY", "SM2 PRIVATE KEY":
+		return smx509.ParseTypedECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		return smx509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %s", block.Type)
+	}
+}
+
+// Sign sets the minted JWT into the request header.
+func (s *JWTSigner) Sign(r *http.Request) error {
+	token, err := s.Mint()
+	if err != nil {
+		return err
+	}
+
+	if strings.EqualFold(s.Header, "Authorization") {
+		token = "Bearer " + token
+	}
+	r.Header.Set(s.Header, token)
+	return nil
+}
+
+// Mint evaluates the claims template and signs the JWT.
+func (s *JWTSigner) Mint() (string, error) {
+	valuerLock.Lock()
+	claimsJSON := Eval(s.Claims)
+	valuerLock.Unlock()
+
+	claims := map[string]interface{}{}
+	d := json.NewDecoder(strings.NewReader(claimsJSON))
+	d.UseNumber()
+	if err := d.Decode(&claims); err != nil {
+		return "", fmt.Errorf("jwt claims %s: %w", claimsJSON, err)
+	}
+	if s.TTL > 0 {
+		now := time.Now()
+		if _, ok := claims["iat"]; !ok {
+			claims["iat"] = now.Unix()
+		}
+		if _, ok := claims["exp"]; !ok {
+			claims["exp"] = now.Add(s.TTL).Unix()
+		}
+	}
+
+	header := map[string]string{"alg": s.Alg, "typ": "JWT"}
+	if s.Kid != "" {
+		header["kid"] = s.Kid
+	}
+
+	h, _ := json.Marshal(header)
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	input := enc.EncodeToString(h) + "." + enc.EncodeToString(c)
+	sig, err := s.sign([]byte(input))
+	if err != nil {
+		return "", fmt.Errorf("jwt sign: %w", err)
+	}
+
+	if HasPrintOption(printDebug) {
+		log.Printf("jwt header: %s, claims: %s", h, c)
+	}
+	return input + "." + enc.EncodeToString(sig), nil
+}
+
+func (s *JWTSigner) sign(input []byte) ([]byte, error) {
+	switch k := s.Key.(type) {
+	case []byte:
+		m := hmac.New(sha256.New, k)
+		m.Write(input)
+		return m.Sum(nil), nil
+	case *rsa.PrivateKey:
+		sum := sha256.Sum256(input)
+		return rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, sum[:])
+	case *ecdsa.PrivateKey:
+		sum := sha256.Sum256(input)
+		r, ss, err := ecdsa.Sign(rand.Reader, k, sum[:])
+		if err != nil {
+			return nil, err
+		}
+		return jwtRawSignature(r, ss), nil
+	case *sm2.PrivateKey:
+		// the SM2 signature with the SM3 hash and the default user id, encoded in ASN.1
+		der, err := k.Sign(rand.Reader, input, sm2.DefaultSM2SignerOpts)
+		if err != nil {
+			return nil, err
+		}
+		var rs struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(der, &rs); err != nil {
+			return nil, err
+		}
+		return jwtRawSignature(rs.R, rs.S), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", s.Key)
+	}
+}
+
+// jwtRawSignature returns the JWS form of the elliptic curve signature, the 32 bytes r and s concatenated.
+func jwtRawSignature(r, s *big.Int) []byte {
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return sig
+}
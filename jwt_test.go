@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/emmansun/gmsm/sm2"
+)
+
+func TestJWTSigner(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	sm2Key, _ := sm2.GenerateKey(rand.Reader)
+
+	cases := []struct {
+		alg    string
+		key    interface{}
+		verify func(input, sig []byte) bool
+	}{
+		{"HS256", []byte("secret"), func(input, sig []byte) bool {
+			m := hmac.New(sha256.New, []byte("secret"))
+			m.Write(input)
+			return hmac.Equal(m.Sum(nil), sig)
+		}},
+		{"ES256", ecKey, func(input, sig []byte) bool {
+			sum := sha256.Sum256(input)
+			r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+			return ecdsa.Verify(&ecKey.PublicKey, sum[:], r, s)
+		}},
+		{"SM2-SM3", sm2Key, func(input, sig []byte) bool {
+			der, _ := asn1.Marshal(struct{ R, S *big.Int }{new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])})
+			return sm2.VerifyASN1WithSM2(&sm2Key.PublicKey, nil, input, der)
+		}},
+	}
+
+	for _, c := range cases {
+		s := &JWTSigner{Alg: c.alg, Key: c.key, Claims: `{"sub":"bob","iat":1}`, TTL: 0}
+		token, err := s.Mint()
+		if err != nil {
+			t.Fatalf("%s: %v", c.alg, err)
+		}
+
+		parts := strings.Split(token, ".")
+		if len(parts) != 3 {
+			t.Fatalf("%s: bad token %s", c.alg, token)
+		}
+		header, _ := base64.RawURLEncoding.DecodeString(parts[0])
+		claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		if string(header) != `{"alg":"`+c.alg+`","typ":"JWT"}` || string(claims) != `{"iat":1,"sub":"bob"}` {
+			t.Errorf("%s: bad header %s or claims %s", c.alg, header, claims)
+		}
+		if !c.verify([]byte(parts[0]+"."+parts[1]), sig) {
+			t.Errorf("%s: bad signature", c.alg)
+		}
+	}
+}
+
+func TestJWTSignerTTL(t *testing.T) {
+	s := &JWTSigner{Alg: "HS256", Key: []byte("k"), Claims: `{"sub":"bob","nbf":@now(-1m)}`, TTL: 300e9}
+	token, err := s.Mint()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[1])
+	var claims struct{ Iat, Exp, Nbf int64 }
+	_ = json.Unmarshal(data, &claims)
+	if claims.Exp-claims.Iat != 300 || claims.Iat-claims.Nbf != 60 {
+		t.Errorf("bad time claims %s", data)
+	}
+}
+
+func TestLoadJWTKey(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "hmac.key")
+	_ = os.WriteFile(keyFile, []byte("from-file"), 0o600)
+	t.Setenv("GURL_TEST_JWT_KEY", "from-env")
+
+	for spec, want := range map[string]string{
+		"secret:s3cret":      "s3cret",
+		"$GURL_TEST_JWT_KEY": "from-env",
+		keyFile:              "from-file",
+		"@" + keyFile:        "from-file",
+	} {
+		alg, key, err := loadJWTKey(spec, "")
+		if err != nil || alg != "HS256" || string(key.([]byte)) != want {
+			t.Errorf("%s: %s %v %v, want %s", spec, alg, key, err, want)
+		}
+	}
+
+	// a typo in the key file name is an error, never the literal secret.
+	for _, spec := range []string{"key.pem", "@key.pem", "secret:"} {
+		if _, _, err := loadJWTKey(spec, ""); err == nil {
+			t.Errorf("%s: error expected", spec)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"crypto/md5"
 	"crypto/sha256"
@@ -25,7 +26,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/bingoohuang/gg/pkg/codec/b64"
 	"github.com/bingoohuang/gg/pkg/fla9"
 	"github.com/bingoohuang/gg/pkg/osx"
 	"github.com/bingoohuang/gg/pkg/osx/env"
@@ -34,8 +34,8 @@ import (
 	"github.com/bingoohuang/gg/pkg/thinktime"
 	"github.com/bingoohuang/gg/pkg/v"
 	"github.com/bingoohuang/goup"
+	"github.com/bingoohuang/gurl/internal/envfile"
 	"github.com/emmansun/gmsm/sm3"
-	_ "github.com/joho/godotenv/autoload"
 	"github.com/zeebo/blake3"
 )
 
@@ -49,6 +49,22 @@ func main() {
 		log.Fatalf("failed to parse args, %v", err)
 	}
 
+	for k, v := range envfile.Vars {
+		valuer.SetVar(k, v)
+	}
+
+	if args := fla9.Args(); len(args) > 0 && args[0] == "test" {
+		parsePrintOption(printV)
+		logEnvFiles()
+		os.Exit(runTestSuites(args[1:]))
+	}
+	if args := fla9.Args(); len(args) > 0 && args[0] == "cert" {
+		os.Exit(runCertCommand(args[1:]))
+	}
+	if args := fla9.Args(); len(args) > 0 && args[0] == "serve" {
+		os.Exit(runServeCommand(args[1:]))
+	}
+
 	nonFlagArgs := filter(fla9.Args())
 
 	if ver {
@@ -72,25 +88,49 @@ func main() {
 	disableProxy = HasPrintOption(optionDisableProxy)
 
 	pretty = !raw
+	logEnvFiles()
 
 	if !HasPrintOption(printReqBody) {
 		defaultSetting.DumpBody = false
 	}
 
-	if len(urls) == 0 {
-		urls = []string{DryRequestURL}
+	if exportFormat != "" {
+		if !inSlice(exportFormat, exportFormats) {
+			log.Fatalf("unknown export format %q, should be one of %s", exportFormat, strings.Join(exportFormats, "|"))
+		}
+		benchN, benchC = 1, 1
 	}
 
-	stdin := parseStdin()
+	setupExpectations(expectSpecs)
+	setupExtractors(extractSpecs, extractFile)
 
 	start := time.Now()
-	for _, urlAddr := range urls {
-		run(len(urls), urlAddr, nonFlagArgs, stdin)
+	if httpFile != "" {
+		runHTTPFile(httpFile, nonFlagArgs)
+	} else {
+		if len(urls) == 0 {
+			urls = []string{DryRequestURL}
+		}
+
+		stdin := parseStdin()
+		for _, urlAddr := range urls {
+			run(len(urls), urlAddr, nonFlagArgs, stdin)
+		}
 	}
 
 	if HasPrintOption(printVerbose) {
 		log.Printf("complete, total cost: %s", time.Since(start))
 	}
+
+	if expectExitCode != 0 {
+		os.Exit(expectExitCode)
+	}
+}
+
+func logEnvFiles() {
+	if HasPrintOption(printVerbose) && len(envfile.Files) > 0 {
+		log.Printf("env profile: %q, env files: %s", envfile.Name, strings.Join(envfile.Files, ", "))
+	}
 }
 
 func parseStdin() io.Reader {
@@ -118,7 +158,8 @@ func run(totalUrls int, urlAddr string, nonFlagArgs []string, reader io.Reader)
 	}
 
 	urlAddr2 := Eval(urlAddr)
-	u := rest.FixURI(urlAddr2,
+	socket, fixedAddr := parseUnixSocketURL(urlAddr2)
+	u := rest.FixURI(fixedAddr,
 		rest.WithFatalErr(true),
 		rest.WithDefaultScheme(ss.If(caFile != "", "https", "http")),
 	).Data
@@ -126,7 +167,8 @@ func run(totalUrls int, urlAddr string, nonFlagArgs []string, reader io.Reader)
 	addrGen := func() *url.URL { return u }
 	if urlAddr2 != urlAddr {
 		addrGen = func() *url.URL {
-			return rest.FixURI(Eval(urlAddr),
+			_, fixedAddr := parseUnixSocketURL(Eval(urlAddr))
+			return rest.FixURI(fixedAddr,
 				rest.WithFatalErr(true),
 				rest.WithDefaultScheme(ss.If(caFile != "", "https", "http")),
 			).Data
@@ -134,28 +176,27 @@ func run(totalUrls int, urlAddr string, nonFlagArgs []string, reader io.Reader)
 	}
 	realURL := addrGen().String()
 	req := getHTTP(method, realURL, nonFlagArgs, timeout)
+	req.Setting.UnixSocket = ss.Or(socket, unixSocket)
 
 	if auth != "" {
-		// check if it is already set by base64 encoded
-		if c, err := b64.DecodeString(auth); err != nil {
-			auth, _ = b64.EncodeString(auth)
-		} else {
-			auth, _ = b64.EncodeString(c)
-		}
+		setupAuth(req)
+	}
+
+	if session != "" {
+		saveSession := setupSession(session, req)
+		defer saveSession()
+	}
 
-		req.Req.Header.Set("Authorization", "Basic "+auth)
+	if cookieJar != "" {
+		saveCookieJar := setupCookieJar(cookieJar, req)
+		defer saveCookieJar()
 	}
 
 	req.Req = req.Req.WithContext(httptrace.WithClientTrace(req.Req.Context(), createClientTrace(req)))
 	setTimeoutRequest(req)
 
 	req.SetTLSClientConfig(createTLSConfig(strings.HasPrefix(realURL, "https://")))
-	if proxyURL := parseProxyURL(req.Req); proxyURL != nil {
-		if HasPrintOption(printVerbose) {
-			log.Printf("Proxy URL: %s", proxyURL)
-		}
-		req.SetProxy(http.ProxyURL(proxyURL))
-	}
+	setupProxy(req)
 
 	if reader != nil {
 		ch := make(chan string)
@@ -172,7 +213,7 @@ func run(totalUrls int, urlAddr string, nonFlagArgs []string, reader io.Reader)
 		}
 	}
 
-	req.SetupTransport()
+	setupTransport(req)
 	req.BuildURL()
 
 	if benchC > 1 { // AB bench
@@ -210,6 +251,31 @@ func run(totalUrls int, urlAddr string, nonFlagArgs []string, reader io.Reader)
 	}
 }
 
+// setupProxy sets the proxy by -proxy or the environment, except for the Unix domain socket.
+func setupProxy(req *Request) {
+	if proxyURL := parseProxyURL(req.Req); proxyURL != nil && req.Setting.UnixSocket == "" {
+		if HasPrintOption(printVerbose) {
+			log.Printf("Proxy URL: %s", proxyURL)
+		}
+		// net/http does the TLS handshake by itself in the CONNECT tunnel, TLCP can not be spoken there.
+		if req.Req.URL.Scheme == "https" && tlcpModeOf(tlcpMode) != "off" {
+			log.Fatalf("-tlcp can not be used with the proxy %s, disable the proxy by -pN or unset HTTPS_PROXY", proxyURL.Redacted())
+		}
+		req.SetProxy(http.ProxyURL(proxyURL))
+	}
+}
+
+// setupTransport sets up the transport of the request, wrapped by the signers of the auth flags.
+func setupTransport(req *Request) {
+	req.SetupTransport()
+	// the innermost one signs last, so the signature covers exactly what is sent.
+	wrapHMACSignTransport(req)
+	wrapDigestTransport(req)
+	wrapAWSSigV4Transport(req)
+	wrapOAuth2Transport(req)
+	wrapJWTTransport(req)
+}
+
 func setTimeoutRequest(req *Request) {
 	if req.Timeout > 0 {
 		var cancelCtx context.Context
@@ -323,6 +389,22 @@ func readStdin(stdin io.Reader, stdinCh chan string) {
 	}
 }
 
+// parseUnixSocketURL parses the http+unix://%2Fvar%2Frun%2Fdocker.sock/info to the socket /var/run/docker.sock
+// and the URL http://localhost/info, other URLs are returned as is.
+func parseUnixSocketURL(rawURL string) (socket, fixedURL string) {
+	scheme, remain, ok := strings.Cut(rawURL, "+unix://")
+	if !ok || scheme != "http" && scheme != "https" {
+		return "", rawURL
+	}
+
+	host, path, _ := strings.Cut(remain, "/")
+	socket, err := url.PathUnescape(host)
+	if err != nil || socket == "" {
+		log.Fatalf("bad unix socket URL %s, should be like http+unix://%%2Fvar%%2Frun%%2Fdocker.sock/info", rawURL)
+	}
+	return socket, scheme + "://localhost/" + path
+}
+
 // Proxy Support
 func parseProxyURL(req *http.Request) *url.URL {
 	if proxy != "" {
@@ -363,6 +445,9 @@ func createTLSConfig(isHTTPS bool) (tlsConfig *tls.Config) {
 		pool.AppendCertsFromPEM(osx.ReadFile(caFile, osx.WithFatalOnError(true)).Data)
 		tlsConfig.RootCAs = pool
 	}
+	setupClientCertificate(tlsConfig)
+	setupTLSOptions(tlsConfig)
+	setupPins(tlsConfig)
 
 	return tlsConfig
 }
@@ -376,6 +461,7 @@ func doRequest(req *Request, addrGen func() *url.URL) error {
 		setBody(req)
 	}
 
+	req.ExpandHeaders()
 	u := addrGen()
 	req.url = u.String()
 
@@ -444,6 +530,7 @@ func doRequestInternal(req *Request, u *url.URL) {
 		uploadFilePb.Start()
 	}
 
+	start := time.Now()
 	res, err := req.Response()
 	if uploadFilePb != nil {
 		uploadFilePb.Finish()
@@ -452,13 +539,26 @@ func doRequestInternal(req *Request, u *url.URL) {
 	if err != nil {
 		log.Fatalf("execute error: %+v", err)
 	}
+	if res.TLS != nil && req.Setting.Proxy != nil {
+		// the TLS connection in the CONNECT tunnel is not made by our dialer, which prints it otherwise.
+		printTLSConnectState(*res.TLS)
+	}
 
-	if processDownload(req, res, pathFileExists, dl, fn, pathFile) {
+	// the head of the downloaded body is kept for the -expect and -extract.
+	head := &limitedBuffer{Buffer: &bytes.Buffer{}, max: maxDownloadCheckBody}
+	if processDownload(req, res, pathFileExists, dl, fn, pathFile, head) {
+		body, unavailable := downloadedBody(res, head)
+		checkExpectations(req, res, body, unavailable, time.Since(start))
+		extractValues(res, body, unavailable)
 		return
 	}
 
 	// 保证 response body 被 读取并且关闭
-	_, _ = req.Bytes()
+	rspBody, _ := req.Bytes()
+	if !req.DryRequest {
+		checkExpectations(req, res, rspBody, "", time.Since(start))
+		extractValues(res, rspBody, "")
+	}
 
 	if isWindows() {
 		printRequestResponseForWindows(req, res)
@@ -471,8 +571,23 @@ func doRequestInternal(req *Request, u *url.URL) {
 	}
 }
 
-func processDownload(req *Request, res *http.Response, pathFileExists bool, dl, fn, pathFile string) bool {
-	if method == "HEAD" || dl == "no" || dl == "n" {
+// maxDownloadCheckBody is the max downloaded body kept in memory for the -expect and -extract.
+const maxDownloadCheckBody = 1 << 20
+
+// downloadedBody returns the downloaded body kept for the -expect and -extract,
+// or the reason why it is unavailable, like a binary or a too large one.
+func downloadedBody(res *http.Response, head *limitedBuffer) ([]byte, string) {
+	if ct := res.Header.Get("Content-Type"); !ss.ContainsFold(ct, "json", "text", "xml") {
+		return nil, "binary body downloaded"
+	}
+	if head.Len() > head.max {
+		return nil, fmt.Sprintf("body larger than %d bytes downloaded", head.max)
+	}
+	return head.Bytes(), ""
+}
+
+func processDownload(req *Request, res *http.Response, pathFileExists bool, dl, fn, pathFile string, head io.Writer) bool {
+	if req.DryRequest || method == "HEAD" || dl == "no" || dl == "n" {
 		return false
 	}
 
@@ -512,7 +627,7 @@ func processDownload(req *Request, res *http.Response, pathFileExists bool, dl,
 			}
 		}
 		if fn != "" {
-			downloadFile(req, res, fn)
+			downloadFile(req, res, fn, head)
 			return true
 		}
 	}
@@ -586,6 +701,10 @@ func printRequestResponseForNonWindows(req *Request, res *http.Response, downloa
 			fmt.Println(Color(res.Status, Green))
 		}
 
+		if HasPrintOption(printRspCookies) {
+			printCookies(req, res)
+		}
+
 		if !download && HasPrintOption(printRspBody) {
 			fmt.Println(formatResponseBody(req, pretty, ugly, freeInnerJSON, influxDB))
 		}
@@ -593,6 +712,7 @@ func printRequestResponseForNonWindows(req *Request, res *http.Response, downloa
 }
 
 func printTLSConnectState(state tls.ConnectionState) {
+	printPeerCertificates("TLS", x509Certificates(state.PeerCertificates))
 	if !HasPrintOption(printRspOption) {
 		return
 	}
@@ -612,6 +732,9 @@ func printTLSConnectState(state tls.ConnectionState) {
 		}
 	}(state.Version)
 	fmt.Printf("option TLS.Version: %s\n", tlsVersion)
+	fmt.Printf("option TLS.CipherSuite: %s\n", tls.CipherSuiteName(state.CipherSuite))
+	fmt.Printf("option TLS.ALPN: %s\n", ss.Or(state.NegotiatedProtocol, "none"))
+	fmt.Printf("option TLS.ServerName: %s\n", state.ServerName)
 	fmt.Printf("option TLS.HandshakeComplete: %t\n", state.HandshakeComplete)
 	fmt.Printf("option TLS.DidResume: %t\n", state.DidResume)
 	fmt.Println()
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bingoohuang/gg/pkg/osx"
+	"github.com/bingoohuang/gg/pkg/osx/env"
+)
+
+// OAuth2Token is the access token cached on the disk.
+type OAuth2Token struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	// Expiry is the unix seconds when the token expires, 0 for never.
+	Expiry int64 `json:"expiry,omitempty"`
+}
+
+// valid tells whether the token is still valid, with a small leeway for the clock skew and the network latency.
+func (t *OAuth2Token) valid() bool {
+	return t != nil && t.AccessToken != "" && (t.Expiry == 0 || time.Now().Add(30*time.Second).Unix() < t.Expiry)
+}
+
+// OAuth2Config is the config of the OAuth2 client credentials or resource owner password grant.
+type OAuth2Config struct {
+	TokenURL               string
+	ClientID, ClientSecret string
+	Scopes                 []string
+	// Username and Password are for the password grant, the client credentials grant is used when empty.
+	Username, Password string
+}
+
+// OAuth2Transport is a http.RoundTripper injecting the bearer access token,
+// it refreshes the token and retries once when the response is 401.
+type OAuth2Transport struct {
+	Config    OAuth2Config
+	Transport http.RoundTripper
+	// Client sends the token requests, apart from the Transport of the target, http.DefaultClient when nil.
+	Client *http.Client
+
+	lock  sync.Mutex
+	token *OAuth2Token
+	file  string
+}
+
+// wrapOAuth2Transport wraps the request transport to do the OAuth2 authorization.
+func wrapOAuth2Transport(req *Request) {
+	if oauth2TokenURL == "" {
+		return
+	}
+
+	c := OAuth2Config{TokenURL: oauth2TokenURL}
+	c.ClientID, c.ClientSecret, _ = strings.Cut(readCredentials(oauth2Client), ":")
+	if oauth2User != "" {
+		c.Username, c.Password, _ = strings.Cut(readCredentials(oauth2User), ":")
+	}
+	c.Scopes = strings.FieldsFunc(oauth2Scope, func(r rune) bool { return r == ' ' || r == ',' })
+
+	t := NewOAuth2Transport(c, req.Transport)
+	t.Client = newOAuth2Client()
+	req.Transport = t
+}
+
+// newOAuth2Client creates the plain client for the token requests, which honours only the CA, the proxy and TLS_VERIFY,
+// not the -sni, -pin, -unix-socket, TLCP or the signers meant for the target.
+func newOAuth2Client() *http.Client {
+	tlsConfig := &tls.Config{InsecureSkipVerify: !env.Bool(`TLS_VERIFY`, false)}
+	if caFile != "" {
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(osx.ReadFile(caFile, osx.WithFatalOnError(true)).Data)
+		tlsConfig.RootCAs = pool
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: func(r *http.Request) (*url.URL, error) { return parseProxyURL(r), nil }},
+	}
+}
+
+// NewOAuth2Transport creates the OAuth2Transport with the token cache file under the user cache dir.
+func NewOAuth2Transport(c OAuth2Config, transport http.RoundTripper) *OAuth2Transport {
+	t := &OAuth2Transport{Config: c, Transport: transport}
+
+	if dir, err := os.UserCacheDir(); err == nil {
+		// the secrets are in the key too, so a changed secret never reuses the token of the old one,
+		// only the hash of the key is in the file name.
+		key := strings.Join([]string{c.TokenURL, c.ClientID, c.ClientSecret, c.Username, c.Password, strings.Join(c.Scopes, " ")}, "\n")
+		sum := sha256.Sum256([]byte(key))
+		t.file = filepath.Join(dir, "gurl", "oauth2", hex.EncodeToString(sum[:8])+".json")
+	}
+
+	return t
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *OAuth2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+
+	token, err := t.Token(false)
+	if err != nil {
+		return nil, err
+	}
+
+	rsp, err := t.send(req, body, token)
+	if err != nil || rsp.StatusCode != http.StatusUnauthorized {
+		return rsp, err
+	}
+
+	if HasPrintOption(printVerbose) {
+		log.Printf("oauth2: 401 received, refresh the token and retry")
+	}
+	if token, err = t.Token(true); err != nil {
+		return rsp, nil
+	}
+	drainBody(rsp)
+
+	return t.send(req, body, token)
+}
+
+func (t *OAuth2Transport) send(req *http.Request, body []byte, token *OAuth2Token) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	if body != nil {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	}
+
+	token.authorize(r)
+	return t.Transport.RoundTrip(r)
+}
+
+// Sign implements RequestSigner, sets the Authorization by the cached or the newly fetched token.
+func (t *OAuth2Transport) Sign(r *http.Request) error {
+	token, err := t.Token(false)
+	if err != nil {
+		return err
+	}
+	token.authorize(r)
+	return nil
+}
+
+func (t *OAuth2Token) authorize(r *http.Request) {
+	tokenType := t.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+	r.Header.Set("Authorization", tokenType+" "+t.AccessToken)
+}
+
+// Token returns the valid token from the memory or the disk cache, or refreshes it when expired or forced.
+func (t *OAuth2Transport) Token(force bool) (*OAuth2Token, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.token == nil {
+		t.token = t.loadCache()
+	}
+	if !force && t.token.valid() {
+		return t.token, nil
+	}
+
+	var token *OAuth2Token
+	var err error
+	if t.token != nil && t.token.RefreshToken != "" {
+		if token, err = t.fetch(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {t.token.RefreshToken}}); err != nil {
+			log.Printf("oauth2: refresh token failed, request a new one: %v", err)
+		}
+	}
+
+	if token == nil {
+		form := url.Values{"grant_type": {"client_credentials"}}
+		if t.Config.Username != "" {
+			form = url.Values{"grant_type": {"password"}, "username": {t.Config.Username}, "password": {t.Config.Password}}
+		}
+		if len(t.Config.Scopes) > 0 {
+			form.Set("scope", strings.Join(t.Config.Scopes, " "))
+		}
+		if token, err = t.fetch(form); err != nil {
+			return nil, err
+		}
+	}
+
+	if token.RefreshToken == "" && t.token != nil {
+		token.RefreshToken = t.token.RefreshToken
+	}
+	t.token = token
+	t.saveCache()
+	return token, nil
+}
+
+func (t *OAuth2Transport) fetch(form url.Values) (*OAuth2Token, error) {
+	req, err := http.NewRequest(http.MethodPost, t.Config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if t.Config.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(t.Config.ClientID), url.QueryEscape(t.Config.ClientSecret))
+	}
+
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	rsp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oauth2 token request: %w", err)
+	}
+	defer rsp.Body.Close()
+
+	data, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("oauth2 token response: %w", err)
+	}
+
+	var r struct {
+		OAuth2Token
+		ExpiresIn        json.Number `json:"expires_in"`
+		Error            string      `json:"error"`
+		ErrorDescription string      `json:"error_description"`
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("oauth2 token response %d: %s", rsp.StatusCode, data)
+	}
+	if r.Error != "" || rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oauth2 token response %d: %s %s", rsp.StatusCode, r.Error, r.ErrorDescription)
+	}
+	if r.AccessToken == "" {
+		return nil, errors.New("oauth2 token response: access_token is missing")
+	}
+
+	token := r.OAuth2Token
+	if n, err := strconv.ParseInt(r.ExpiresIn.String(), 10, 64); err == nil && n > 0 {
+		token.Expiry = time.Now().Unix() + n
+	}
+
+	if HasPrintOption(printVerbose) {
+		log.Printf("oauth2: token fetched by %s grant, expires in %s", form.Get("grant_type"), r.ExpiresIn)
+	}
+	return &token, nil
+}
+
+func (t *OAuth2Transport) loadCache() *OAuth2Token {
+	if t.file == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(t.file)
+	if err != nil {
+		return nil
+	}
+
+	var token OAuth2Token
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil
+	}
+
+	if HasPrintOption(printVerbose) {
+		log.Printf("oauth2: token loaded from cache %s", t.file)
+	}
+	return &token
+}
+
+func (t *OAuth2Transport) saveCache() {
+	if t.file == "" {
+		return
+	}
+
+	data, _ := json.MarshalIndent(t.token, "", "  ")
+	if err := os.MkdirAll(filepath.Dir(t.file), 0o700); err != nil {
+		log.Printf("oauth2: create cache dir: %v", err)
+		return
+	}
+	if err := os.WriteFile(t.file, data, 0o600); err != nil {
+		log.Printf("oauth2: write cache %s: %v", t.file, err)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOAuth2Transport(t *testing.T) {
+	issued, grants := 0, []string{}
+	valid := map[string]bool{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if r.Header.Get("X-Signed") != "" {
+				// the signers are meant for the target only.
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_ = r.ParseForm()
+			if id, secret, _ := r.BasicAuth(); id != "cid" || secret != "sec" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			issued++
+			token := fmt.Sprintf("t%d", issued)
+			valid[token] = true
+			grants = append(grants, r.Form.Get("grant_type")+":"+r.Form.Get("username")+":"+r.Form.Get("scope"))
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token": token, "token_type": "bearer", "expires_in": 3600, "refresh_token": "r" + token,
+			})
+			return
+		}
+
+		if !valid[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")] {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	}))
+	defer ts.Close()
+
+	c := OAuth2Config{TokenURL: ts.URL + "/token", ClientID: "cid", ClientSecret: "sec", Username: "bob", Password: "pw", Scopes: []string{"read"}}
+	tr := NewOAuth2Transport(c, &SignTransport{Signer: bodySigner{header: "X-Signed"}, Transport: http.DefaultTransport})
+	tr.file = filepath.Join(t.TempDir(), "token.json")
+
+	post := func() string {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/api", strings.NewReader("hello"))
+		rsp, err := tr.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rsp.Body.Close()
+		body, _ := io.ReadAll(rsp.Body)
+		return fmt.Sprintf("%d %s", rsp.StatusCode, body)
+	}
+
+	if got := post(); got != "200 hello" {
+		t.Errorf("first request: %s", got)
+	}
+
+	// the token is revoked, a 401 triggers the refresh and the retry with the same body.
+	valid = map[string]bool{}
+	if got := post(); got != "200 hello" {
+		t.Errorf("retried request: %s", got)
+	}
+
+	// the cached token is reused by a new transport.
+	tr2 := NewOAuth2Transport(c, http.DefaultTransport)
+	tr2.file = tr.file
+	if token, err := tr2.Token(false); err != nil || token.AccessToken != "t2" {
+		t.Errorf("cached token: %+v, %v", token, err)
+	}
+
+	if want := "password:bob:read,refresh_token::"; strings.Join(grants, ",") != want {
+		t.Errorf("grants %v, want %s", grants, want)
+	}
+}
+
+func TestOAuth2CacheFile(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	c := OAuth2Config{TokenURL: "http://127.0.0.1/token", ClientID: "app", ClientSecret: "s1", Username: "bob", Password: "p1"}
+	file := NewOAuth2Transport(c, http.DefaultTransport).file
+	if file == "" || NewOAuth2Transport(c, http.DefaultTransport).file != file {
+		t.Fatalf("cache file %q is not stable", file)
+	}
+
+	for _, change := range []func(*OAuth2Config){
+		func(c *OAuth2Config) { c.ClientSecret = "s2" },
+		func(c *OAuth2Config) { c.Password = "p2" },
+	} {
+		c2 := c
+		change(&c2)
+		if got := NewOAuth2Transport(c2, http.DefaultTransport).file; got == file {
+			t.Errorf("%+v shares the cache file %s", c2, got)
+		}
+	}
+	if base := filepath.Base(file); strings.Contains(base, "s1") || strings.Contains(base, "p1") {
+		t.Errorf("cache file %s leaks the secrets", file)
+	}
+}
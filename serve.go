@@ -0,0 +1,476 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gitee.com/Trisia/gotlcp/tlcp"
+	"github.com/bingoohuang/gg/pkg/man"
+	"github.com/bingoohuang/gg/pkg/osx"
+	"github.com/emmansun/gmsm/smx509"
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+const serveUsage = `Usage: gurl serve [-serve-cert cert.pem -serve-key key.pem] [http|https|tlcp] [ADDR]
+  The echo server returns what it received as JSON, default http on :5003,
+  http serves h2c too, https negotiates h2 by ALPN, and serves HTTP/3 on the same UDP port advertised by Alt-Svc.
+  https uses an ephemeral self-signed certificate when -serve-cert is absent,
+  tlcp uses -serve-cert sign.pem,sign.key,enc.pem,enc.key, or the ephemeral SM2 ones,
+  the client certificates are requested and verified by $CERT if given.
+Query params to control the response:
+  _delay=1s      delay before responding
+  _status=201    response status code
+  _chunked=1     chunked response
+  _gzip=1        gzip response
+Paths:
+  /bytes/10M     deterministic content of the size, supports Range for the download resume testing`
+
+// maxEchoBody is the max body size echoed back, the larger ones are summarized by the length and SHA256 only.
+const maxEchoBody = 64 * 1024
+
+// runServeCommand runs the gurl serve echo server, returns the exit code.
+func runServeCommand(args []string) int {
+	mode, addr := "http", ":5003"
+	for _, arg := range args {
+		switch arg {
+		case "http", "https", "tlcp":
+			mode = arg
+		case "-h", "help":
+			fmt.Println(serveUsage)
+			return 0
+		default:
+			addr = arg
+		}
+	}
+	if !strings.Contains(addr, ":") {
+		addr = ":" + addr
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Printf("serve: %v", err)
+		return 1
+	}
+
+	var handler http.Handler = http.HandlerFunc(serveEcho)
+	switch mode {
+	case "http":
+		handler = h2c.NewHandler(handler, &http2.Server{})
+	case "https":
+		c, err := serveTLSConfig()
+		if err != nil {
+			log.Printf("serve: %v", err)
+			return 1
+		}
+		if handler, err = serveHTTP3(ln.Addr().String(), c, handler); err != nil {
+			log.Printf("serve: %v", err)
+			return 1
+		}
+		ln = tls.NewListener(ln, c)
+	case "tlcp":
+		c, err := serveTLCPConfig()
+		if err != nil {
+			log.Printf("serve: %v", err)
+			return 1
+		}
+		ln = tlcp.NewListener(ln, c)
+	}
+
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: time.Minute,
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, serveConnKey{}, c)
+		},
+	}
+
+	log.Printf("gurl serve %s on %s", mode, ln.Addr())
+	if err := server.Serve(ln); err != nil {
+		log.Printf("serve: %v", err)
+		return 1
+	}
+	return 0
+}
+
+type serveConnKey struct{}
+
+// serveHTTP3 serves HTTP/3 on the same UDP port, and advertises it by the Alt-Svc header of the TCP responses.
+func serveHTTP3(addr string, c *tls.Config, handler http.Handler) (http.Handler, error) {
+	udpConn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &http3.Server{Handler: handler, TLSConfig: http3.ConfigureTLSConfig(c.Clone())}
+	go func() {
+		if err := s.Serve(udpConn); err != nil {
+			log.Printf("serve HTTP/3: %v", err)
+		}
+	}()
+
+	log.Printf("gurl serve HTTP/3 on udp %s", udpConn.LocalAddr())
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = s.SetQuicHeaders(w.Header())
+		handler.ServeHTTP(w, r)
+	}), nil
+}
+
+// serveTLSConfig creates the TLS config by -serve-cert and -serve-key, or the ephemeral self-signed certificate.
+func serveTLSConfig() (*tls.Config, error) {
+	c := &tls.Config{ClientAuth: tls.RequestClientCert, NextProtos: []string{http2.NextProtoTLS, "http/1.1"}}
+	if caFile != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(osx.ReadFile(caFile, osx.WithFatalOnError(true)).Data) {
+			return nil, fmt.Errorf("no CA certificates found in %s", caFile)
+		}
+		c.ClientCAs, c.ClientAuth = pool, tls.VerifyClientCertIfGiven
+	}
+
+	if serveCert != "" {
+		cert, err := loadClientCertificate(serveCert, serveKey, "")
+		if err != nil {
+			return nil, err
+		}
+		c.Certificates = []tls.Certificate{*cert}
+		return c, nil
+	}
+
+	key, err := generateKey(certAlg)
+	if err != nil {
+		return nil, err
+	}
+	der, err := selfSignedCertificate(key, x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("serve with the ephemeral self-signed certificate for localhost,127.0.0.1")
+	c.Certificates = []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}
+	return c, nil
+}
+
+// serveTLCPConfig creates the TLCP config by -serve-cert sign.pem,sign.key,enc.pem,enc.key, or the ephemeral SM2 ones.
+func serveTLCPConfig() (*tlcp.Config, error) {
+	c := &tlcp.Config{ClientAuth: tlcp.RequestClientCert}
+	if caFile != "" {
+		pool := smx509.NewCertPool()
+		if !pool.AppendCertsFromPEM(osx.ReadFile(caFile, osx.WithFatalOnError(true)).Data) {
+			return nil, fmt.Errorf("no CA certificates found in %s", caFile)
+		}
+		c.ClientCAs, c.ClientAuth = pool, tlcp.VerifyClientCertIfGiven
+	}
+
+	if serveCert != "" {
+		certs, err := loadTLCPCertificates(serveCert, readCredentials(tlcpKeyPass))
+		if err != nil {
+			return nil, err
+		}
+		if len(certs) != 2 {
+			return nil, fmt.Errorf("TLCP server requires both the sign and the enc certificates")
+		}
+		c.Certificates = certs
+		return c, nil
+	}
+
+	encUsage := x509.KeyUsageKeyEncipherment | x509.KeyUsageDataEncipherment | x509.KeyUsageKeyAgreement
+	for _, usage := range []x509.KeyUsage{x509.KeyUsageDigitalSignature, encUsage} {
+		key, err := generateKey("sm2")
+		if err != nil {
+			return nil, err
+		}
+		der, err := selfSignedCertificate(key, usage)
+		if err != nil {
+			return nil, err
+		}
+		leaf, _ := smx509.ParseCertificate(der)
+		c.Certificates = append(c.Certificates, tlcp.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf})
+	}
+	log.Printf("serve with the ephemeral self-signed SM2 sign/enc certificates for localhost,127.0.0.1")
+	return c, nil
+}
+
+func selfSignedCertificate(key crypto.Signer, usage x509.KeyUsage) ([]byte, error) {
+	tmpl := certTemplate("localhost", 1)
+	tmpl.KeyUsage = usage
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	tmpl.DNSNames = []string{"localhost"}
+	tmpl.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	return smx509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+}
+
+// EchoResult is what the gurl serve echoes back.
+type EchoResult struct {
+	Method     string              `json:"method"`
+	URL        string              `json:"url"`
+	Proto      string              `json:"proto"`
+	Remote     string              `json:"remote"`
+	Host       string              `json:"host"`
+	Headers    map[string]string   `json:"headers"`
+	Query      map[string][]string `json:"query,omitempty"`
+	Body       string              `json:"body,omitempty"`
+	BodyLength int64               `json:"bodyLength"`
+	BodySHA256 string              `json:"bodySha256,omitempty"`
+	Files      []EchoFile          `json:"files,omitempty"`
+	TLS        *EchoTLS            `json:"tls,omitempty"`
+}
+
+// EchoFile is the summary of the uploaded multipart file.
+type EchoFile struct {
+	Field  string `json:"field"`
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// EchoTLS is the TLS or TLCP details of the connection.
+type EchoTLS struct {
+	Version     string     `json:"version"`
+	CipherSuite string     `json:"cipherSuite"`
+	ServerName  string     `json:"serverName,omitempty"`
+	ALPN        string     `json:"alpn,omitempty"`
+	DidResume   bool       `json:"didResume"`
+	ClientCerts []EchoCert `json:"clientCerts,omitempty"`
+	Verified    bool       `json:"verified"`
+}
+
+// EchoCert is the summary of the client certificate.
+type EchoCert struct {
+	Subject  string `json:"subject"`
+	Issuer   string `json:"issuer"`
+	Serial   string `json:"serial"`
+	NotAfter string `json:"notAfter"`
+}
+
+func serveEcho(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if d, err := time.ParseDuration(q.Get("_delay")); err == nil && d > 0 {
+		select {
+		case <-time.After(d):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if size, ok := strings.CutPrefix(r.URL.Path, "/bytes/"); ok {
+		serveBytes(w, r, size)
+		return
+	}
+
+	result, err := echoRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	status := http.StatusOK
+	if s, err := strconv.Atoi(q.Get("_status")); err == nil && s >= 100 && s < 600 {
+		status = s
+	}
+
+	data, _ := json.MarshalIndent(result, "", "  ")
+	data = append(data, '\n')
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	var out io.Writer = w
+	if q.Get("_gzip") != "" {
+		w.Header().Set("Content-Encoding", "gzip")
+		gw := gzip.NewWriter(w)
+		defer gw.Close()
+		out = gw
+	}
+	chunked := q.Get("_chunked") != ""
+	if !chunked && q.Get("_gzip") == "" {
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	}
+	w.WriteHeader(status)
+	log.Printf("%s %s %s %d", r.RemoteAddr, r.Method, r.URL.RequestURI(), status)
+
+	if !chunked {
+		_, _ = out.Write(data)
+		return
+	}
+
+	// write in chunks with flushing, so that the response is sent by the chunked transfer encoding.
+	flusher, _ := w.(http.Flusher)
+	for len(data) > 0 {
+		n := len(data)
+		if n > 64 {
+			n = 64
+		}
+		_, _ = out.Write(data[:n])
+		if gw, ok := out.(*gzip.Writer); ok {
+			_ = gw.Flush()
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		data = data[n:]
+	}
+}
+
+func echoRequest(r *http.Request) (*EchoResult, error) {
+	result := &EchoResult{
+		Method:  r.Method,
+		URL:     r.URL.RequestURI(),
+		Proto:   r.Proto,
+		Remote:  r.RemoteAddr,
+		Host:    r.Host,
+		Headers: map[string]string{},
+		Query:   r.URL.Query(),
+		TLS:     echoTLS(r),
+	}
+	for k, v := range r.Header {
+		result.Headers[k] = strings.Join(v, ", ")
+	}
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		return result, echoMultipart(r, result)
+	}
+
+	h := sha256.New()
+	var body bytes.Buffer
+	n, err := io.Copy(io.MultiWriter(h, &limitedBuffer{Buffer: &body, max: maxEchoBody}), r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	result.BodyLength = n
+	if n > 0 {
+		result.BodySHA256 = hex.EncodeToString(h.Sum(nil))
+	}
+	if n <= maxEchoBody && utf8.Valid(body.Bytes()) {
+		result.Body = body.String()
+	}
+	return result, nil
+}
+
+func echoMultipart(r *http.Request, result *EchoResult) error {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return err
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		h := sha256.New()
+		n, err := io.Copy(h, part)
+		if err != nil {
+			return err
+		}
+		result.BodyLength += n
+		result.Files = append(result.Files, EchoFile{
+			Field: part.FormName(), Name: part.FileName(), Size: n, SHA256: hex.EncodeToString(h.Sum(nil)),
+		})
+	}
+}
+
+func echoTLS(r *http.Request) *EchoTLS {
+	if s := r.TLS; s != nil {
+		e := &EchoTLS{
+			Version: tls.VersionName(s.Version), CipherSuite: tls.CipherSuiteName(s.CipherSuite),
+			ServerName: s.ServerName, ALPN: s.NegotiatedProtocol, DidResume: s.DidResume,
+			Verified: len(s.VerifiedChains) > 0,
+		}
+		e.ClientCerts = echoCerts(x509Certificates(s.PeerCertificates))
+		return e
+	}
+
+	type tlcpConnectionStater interface {
+		ConnectionState() tlcp.ConnectionState
+	}
+	if c, ok := r.Context().Value(serveConnKey{}).(tlcpConnectionStater); ok {
+		s := c.ConnectionState()
+		return &EchoTLS{
+			Version: "TLCP", CipherSuite: tlcp.CipherSuiteName(s.CipherSuite), ServerName: s.ServerName,
+			DidResume: s.DidResume, Verified: len(s.VerifiedChains) > 0, ClientCerts: echoCerts(s.PeerCertificates),
+		}
+	}
+	return nil
+}
+
+func echoCerts(certs []*smx509.Certificate) []EchoCert {
+	var result []EchoCert
+	for _, c := range certs {
+		result = append(result, EchoCert{
+			Subject: c.Subject.String(), Issuer: c.Issuer.String(),
+			Serial: fmt.Sprintf("%X", c.SerialNumber), NotAfter: c.NotAfter.Format(time.RFC3339),
+		})
+	}
+	return result
+}
+
+// serveBytes serves the deterministic content of the size, with Range, ETag and Last-Modified for the download resume.
+func serveBytes(w http.ResponseWriter, r *http.Request, size string) {
+	n, err := man.ParseBytes(size)
+	if err != nil {
+		http.Error(w, "bad size "+size, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("ETag", fmt.Sprintf(`"bytes-%d"`, n))
+	log.Printf("%s %s %s %s", r.RemoteAddr, r.Method, r.URL.RequestURI(), r.Header.Get("Range"))
+	http.ServeContent(w, r, "bytes", time.Unix(0, 0), &patternReader{size: int64(n)})
+}
+
+// patternReader is an io.ReadSeeker of the repeated printable pattern, the byte at offset i is always the same.
+type patternReader struct {
+	size, off int64
+}
+
+const bytesPattern = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ\n"
+
+func (p *patternReader) Read(b []byte) (int, error) {
+	if p.off >= p.size {
+		return 0, io.EOF
+	}
+	if rest := p.size - p.off; int64(len(b)) > rest {
+		b = b[:rest]
+	}
+	for i := range b {
+		b[i] = bytesPattern[(p.off+int64(i))%int64(len(bytesPattern))]
+	}
+	p.off += int64(len(b))
+	return len(b), nil
+}
+
+func (p *patternReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += p.off
+	case io.SeekEnd:
+		offset += p.size
+	}
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+	p.off = offset
+	return offset, nil
+}
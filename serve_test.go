@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServeEcho(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(serveEcho))
+	defer server.Close()
+
+	rsp, err := http.Post(server.URL+"/x?a=1&_status=201&_gzip=1", "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+
+	var result EchoResult
+	if err := json.NewDecoder(rsp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if rsp.StatusCode != 201 || result.Method != "POST" || result.Body != "hello" || result.Query["a"][0] != "1" {
+		t.Errorf("bad echo %d %+v", rsp.StatusCode, result)
+	}
+
+	req, _ := http.NewRequest("GET", server.URL+"/bytes/1KiB", nil)
+	req.Header.Set("Range", "bytes=10-19")
+	rsp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+
+	data, _ := io.ReadAll(rsp.Body)
+	if rsp.StatusCode != http.StatusPartialContent || string(data) != "abcdefghij" {
+		t.Errorf("bad range %d %q", rsp.StatusCode, data)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Session is a persistent named session which keeps cookies, headers and auth across gurl invocations.
+type Session struct {
+	Headers map[string]string `json:"headers,omitempty"`
+	Auth    string            `json:"auth,omitempty"`
+	// Protocol is TLS or TLCP detected by the -tlcp auto mode.
+	Protocol string `json:"protocol,omitempty"`
+	CookieStore
+
+	file string
+}
+
+// sessionFile returns the session file path, by name under the user config dir grouped by host,
+// or the name itself when it looks like a path.
+func sessionFile(name, host string) (string, error) {
+	if strings.ContainsAny(name, `/\`) || strings.HasSuffix(name, ".json") {
+		return name, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	host = strings.ReplaceAll(host, ":", "_")
+	return filepath.Join(dir, "gurl", "sessions", host, name+".json"), nil
+}
+
+// LoadSession loads the named session for the host, a new empty session will be returned if it does not exist.
+func LoadSession(name, host string) (*Session, error) {
+	file, err := sessionFile(name, host)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{file: file}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Save saves the session to its file.
+func (s *Session) Save() error {
+	s.RemoveExpired()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.file), 0o700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(s.file, data, 0o600)
+}
+
+// sessionIgnoredHeader tells whether the header should not be stored in the session.
+func sessionIgnoredHeader(k string) bool {
+	k = http.CanonicalHeaderKey(k)
+	return strings.HasPrefix(k, "Content-") || strings.HasPrefix(k, "If-") ||
+		k == "Authorization" || k == "Cookie" || k == "Host"
+}
+
+// Apply applies the session headers, auth and cookies to the request,
+// the values set in the command line take precedence over the session ones.
+func (s *Session) Apply(r *Request) {
+	s.applyHeaders(r)
+	r.Jar = s.NewJar()
+}
+
+// applyHeaders applies the session headers, auth and the detected protocol to the request, without the cookies.
+func (s *Session) applyHeaders(r *Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for k, v := range s.Headers {
+		if r.Req.Header.Get(k) == "" {
+			r.Header(k, v)
+		}
+	}
+
+	if s.Auth != "" && r.Req.Header.Get("Authorization") == "" {
+		r.Header("Authorization", s.Auth)
+	}
+
+	if s.Protocol != "" {
+		tlsProtocols.LoadOrStore(urlHostPort(r.Req.URL), s.Protocol)
+	}
+}
+
+// Update updates the session with the headers given in the request items and the request auth.
+func (s *Session) Update(r *Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, k := range r.headerItems {
+		if sessionIgnoredHeader(k) {
+			continue
+		}
+		if s.Headers == nil {
+			s.Headers = map[string]string{}
+		}
+		s.Headers[http.CanonicalHeaderKey(k)] = r.Req.Header.Get(k)
+	}
+
+	if a := r.Req.Header.Get("Authorization"); a != "" {
+		s.Auth = a
+	}
+
+	if p, ok := tlsProtocols.Load(urlHostPort(r.Req.URL)); ok {
+		s.Protocol = p.(string)
+	}
+}
+
+// setupSession loads the named session and applies it to the request,
+// the returned function should be called to save the session after the request is done.
+func setupSession(name string, r *Request) func() {
+	s, err := LoadSession(name, r.Req.URL.Host)
+	if err != nil {
+		log.Fatalf("load session %s: %v", name, err)
+	}
+
+	if HasPrintOption(printVerbose) {
+		log.Printf("session file: %s", s.file)
+	}
+
+	s.Apply(r)
+
+	return func() {
+		s.Update(r)
+		if err := s.Save(); err != nil {
+			log.Printf("save session %s: %v", s.file, err)
+		}
+	}
+}
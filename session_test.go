@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSessionPersistence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "api.json")
+	s, err := LoadSession(file, "api.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRequest("http://api.example.com/v1/login", http.MethodPost)
+	r.Header("X-Tenant", "t1")
+	r.Header("Content-Type", "application/json")
+	r.Header("Authorization", "Bearer tok")
+	r.headerItems = []string{"X-Tenant", "Content-Type", "Authorization"}
+	s.Apply(r)
+
+	// the cookies set by the server are recorded to the session by the jar.
+	r.Jar.SetCookies(r.Req.URL, []*http.Cookie{
+		{Name: "sid", Value: "abc", Path: "/"},
+		{Name: "gone", Value: "x", Path: "/", Expires: time.Now().Add(-time.Hour)},
+	})
+	s.Update(r)
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if fi, err := os.Stat(file); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Fatalf("session file %v, %v", fi, err)
+	}
+
+	s2, err := LoadSession(file, "api.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s2.Headers) != 1 || s2.Headers["X-Tenant"] != "t1" {
+		t.Errorf("headers %v, want only X-Tenant", s2.Headers)
+	}
+	if s2.Auth != "Bearer tok" {
+		t.Errorf("auth %q", s2.Auth)
+	}
+	if len(s2.Cookies) != 1 || s2.Cookies[0].Name != "sid" || !s2.Cookies[0].HostOnly {
+		t.Errorf("cookies %+v", s2.Cookies)
+	}
+
+	// the headers given in the command line take precedence over the session ones.
+	r2 := NewRequest("http://api.example.com/v1/me", http.MethodGet)
+	r2.Header("X-Tenant", "t2")
+	s2.Apply(r2)
+	if got := r2.Req.Header.Get("X-Tenant"); got != "t2" {
+		t.Errorf("X-Tenant %q, want t2", got)
+	}
+	if got := r2.Req.Header.Get("Authorization"); got != "Bearer tok" {
+		t.Errorf("Authorization %q, want the session one", got)
+	}
+	if cookies := r2.Jar.Cookies(r2.Req.URL); len(cookies) != 1 || cookies[0].String() != "sid=abc" {
+		t.Errorf("jar cookies %v", cookies)
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/emmansun/gmsm/sm3"
+	"gopkg.in/yaml.v3"
+)
+
+// HMACSigner signs the requests by the declarative config loaded by -sign sign.yaml, like:
+//
+//	algorithm: hmac-sha256      # hmac-sha256, hmac-sha1 or hmac-sm3
+//	key: $PARTNER_SECRET        # @file, $ENV or the literal key
+//	encoding: hex               # hex or base64 of the signature
+//	vars:                       # evaluated for every request
+//	  ts: "@now"
+//	  nonce: "@uuid"
+//	canonical: "{method}\n{path}\n{query}\n{ts}\n{nonce}\n{body_sha256}"
+//	headers:
+//	  X-Timestamp: "{ts}"
+//	  X-Nonce: "{nonce}"
+//	  X-Signature: "{signature}"
+//	query:
+//	  app_id: abc
+//
+// The placeholders are the vars, {signature}, {method}, {scheme}, {host}, {path}, {raw_query}, {query} (sorted and encoded),
+// {uri}, {body}, {body_sha256}, {body_sm3}, {body_md5}, {header.Name} and {query.name}.
+// The headers and query params without {signature} are set before the canonical string is built, so that they can be covered.
+type HMACSigner struct {
+	Algorithm string            `yaml:"algorithm"`
+	Key       string            `yaml:"key"`
+	Encoding  string            `yaml:"encoding"`
+	Vars      map[string]string `yaml:"vars"`
+	Canonical string            `yaml:"canonical"`
+	Headers   map[string]string `yaml:"headers"`
+	Query     map[string]string `yaml:"query"`
+
+	hash func() hash.Hash
+}
+
+// wrapHMACSignTransport wraps the request transport to sign the requests by the -sign config.
+func wrapHMACSignTransport(req *Request) {
+	if signConfig == "" {
+		return
+	}
+
+	s, err := LoadHMACSigner(signConfig)
+	if err != nil {
+		log.Fatalf("sign: %v", err)
+	}
+
+	req.Transport = &SignTransport{Signer: s, Transport: req.Transport}
+}
+
+// LoadHMACSigner loads the signer from the YAML config file.
+func LoadHMACSigner(file string) (*HMACSigner, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &HMACSigner{}
+	if err := yaml.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", file, err)
+	}
+	if err := s.init(); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	return s, nil
+}
+
+func (s *HMACSigner) init() error {
+	switch strings.ToLower(s.Algorithm) {
+	case "", "hmac-sha256":
+		s.hash = sha256.New
+	case "hmac-sha1":
+		s.hash = sha1.New
+	case "hmac-sm3":
+		s.hash = sm3.New
+	default:
+		return fmt.Errorf("unknown algorithm %s, should be one of hmac-sha256|hmac-sha1|hmac-sm3", s.Algorithm)
+	}
+
+	switch strings.ToLower(s.Encoding) {
+	case "", "hex", "base64":
+	default:
+		return fmt.Errorf("unknown encoding %s, should be hex or base64", s.Encoding)
+	}
+
+	if s.Canonical == "" {
+		return fmt.Errorf("canonical is required")
+	}
+	s.Key = readCredentials(s.Key)
+	return nil
+}
+
+var signPlaceholder = regexp.MustCompile(`\{([^{}\s]+)}`)
+
+// Sign sets the signature headers and query params into the request, the body is read into memory for the body hashes.
+func (s *HMACSigner) Sign(r *http.Request) error {
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(r.Body); err != nil {
+			return fmt.Errorf("sign: %w", err)
+		}
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	}
+
+	vars := map[string]string{}
+	valuerLock.Lock()
+	for k, v := range s.Vars {
+		vars[k] = Eval(v)
+	}
+	valuerLock.Unlock()
+
+	lookup := func(name string) (string, error) {
+		if v, ok := vars[name]; ok {
+			return v, nil
+		}
+		return signValue(r, body, name)
+	}
+
+	if err := s.place(r, lookup, false); err != nil {
+		return err
+	}
+
+	canonical, err := expandSignTemplate(s.Canonical, lookup)
+	if err != nil {
+		return err
+	}
+
+	m := hmac.New(s.hash, []byte(s.Key))
+	m.Write([]byte(canonical))
+	if strings.EqualFold(s.Encoding, "base64") {
+		vars["signature"] = base64.StdEncoding.EncodeToString(m.Sum(nil))
+	} else {
+		vars["signature"] = hex.EncodeToString(m.Sum(nil))
+	}
+
+	if HasPrintOption(printDebug) {
+		log.Printf("sign canonical string:\n%s", canonical)
+	}
+
+	return s.place(r, lookup, true)
+}
+
+// place sets the headers and query params with or without the {signature} placeholder.
+func (s *HMACSigner) place(r *http.Request, lookup func(string) (string, error), withSignature bool) error {
+	for k, v := range s.Headers {
+		if strings.Contains(v, "{signature}") != withSignature {
+			continue
+		}
+		x, err := expandSignTemplate(v, lookup)
+		if err != nil {
+			return err
+		}
+		r.Header.Set(k, x)
+	}
+
+	if len(s.Query) == 0 {
+		return nil
+	}
+
+	q := r.URL.Query()
+	changed := false
+	for k, v := range s.Query {
+		if strings.Contains(v, "{signature}") != withSignature {
+			continue
+		}
+		x, err := expandSignTemplate(v, lookup)
+		if err != nil {
+			return err
+		}
+		q.Set(k, x)
+		changed = true
+	}
+	if changed {
+		r.URL.RawQuery = q.Encode()
+	}
+	return nil
+}
+
+func expandSignTemplate(tmpl string, lookup func(string) (string, error)) (string, error) {
+	var err error
+	out := signPlaceholder.ReplaceAllStringFunc(tmpl, func(p string) string {
+		v, e := lookup(p[1 : len(p)-1])
+		if e != nil && err == nil {
+			err = e
+		}
+		return v
+	})
+	return out, err
+}
+
+func signValue(r *http.Request, body []byte, name string) (string, error) {
+	if h, ok := strings.CutPrefix(name, "header."); ok {
+		return r.Header.Get(h), nil
+	}
+	if q, ok := strings.CutPrefix(name, "query."); ok {
+		return r.URL.Query().Get(q), nil
+	}
+
+	switch name {
+	case "method":
+		return r.Method, nil
+	case "scheme":
+		return r.URL.Scheme, nil
+	case "host":
+		if r.Host != "" {
+			return r.Host, nil
+		}
+		return r.URL.Host, nil
+	case "path":
+		return r.URL.EscapedPath(), nil
+	case "raw_query":
+		return r.URL.RawQuery, nil
+	case "query":
+		return sortedQuery(r.URL.Query()), nil
+	case "uri":
+		return r.URL.RequestURI(), nil
+	case "body":
+		return string(body), nil
+	case "body_sha256":
+		return hashHex(sha256.New(), body), nil
+	case "body_sm3":
+		return hashHex(sm3.New(), body), nil
+	case "body_md5":
+		return hashHex(md5.New(), body), nil
+	default:
+		return "", fmt.Errorf("sign: unknown placeholder {%s}", name)
+	}
+}
+
+// sortedQuery returns the query params sorted by the names and then the values.
+func sortedQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, k := range keys {
+		vs := append([]string(nil), q[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			pairs = append(pairs, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func hashHex(h hash.Hash, data []byte) string {
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
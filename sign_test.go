@@ -0,0 +1,44 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHMACSigner(t *testing.T) {
+	s := &HMACSigner{
+		Key:       "secret",
+		Vars:      map[string]string{"ts": "1700000000"},
+		Canonical: "{method}\n{path}\n{query}\n{header.X-Ts}\n{body_sha256}",
+		Headers:   map[string]string{"X-Ts": "{ts}", "X-Sign": "key=abc,sig={signature}"},
+		Query:     map[string]string{"app": "a1"},
+	}
+	if err := s.init(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, _ := http.NewRequest("POST", "http://a.b/x%20y?b=2&a=3&a=1", strings.NewReader("hello"))
+	if err := s.Sign(r); err != nil {
+		t.Fatal(err)
+	}
+
+	canonical := "POST\n/x%20y\na=1&a=3&app=a1&b=2\n1700000000\n" +
+		"2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	m := hmac.New(sha256.New, []byte("secret"))
+	m.Write([]byte(canonical))
+	if got, want := r.Header.Get("X-Sign"), "key=abc,sig="+hex.EncodeToString(m.Sum(nil)); got != want {
+		t.Errorf("X-Sign = %s, want %s", got, want)
+	}
+	if r.Header.Get("X-Ts") != "1700000000" || r.URL.Query().Get("app") != "a1" {
+		t.Errorf("bad placement: %v %s", r.Header, r.URL)
+	}
+
+	s.Canonical = "{unknown}"
+	if err := s.Sign(r); err == nil {
+		t.Error("unknown placeholder should fail")
+	}
+}
@@ -0,0 +1,719 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bingoohuang/gg/pkg/rest"
+	"github.com/bingoohuang/gg/pkg/shellwords"
+	"github.com/bingoohuang/gg/pkg/ss"
+	"gopkg.in/yaml.v3"
+)
+
+// Suite is a test suite run by `gurl test suite.yaml`, like:
+//
+//	name: users api
+//	vars:
+//	  host: 127.0.0.1:8080
+//	parallel: 4
+//	setup:
+//	  - name: login
+//	    request: POST @host/login user=admin pass=secret
+//	    extract: {token: data.token}
+//	tests:
+//	  - name: list users
+//	    tags: [smoke]
+//	    request: @host/users Authorization:"Bearer @token"
+//	    expect: [status=200, json:data:array]
+//	  - name: create then get
+//	    steps:
+//	      - request: POST @host/users name=bob Authorization:"Bearer @token"
+//	        extract: {id: data.id}
+//	      - request: @host/users/@id Authorization:"Bearer @token"
+//	        expect: [json:data.name=bob]
+//	teardown:
+//	  - request: POST @host/logout Authorization:"Bearer @token"
+type Suite struct {
+	Name     string       `yaml:"name"`
+	Vars     SuiteVars    `yaml:"vars"`
+	Parallel int          `yaml:"parallel"`
+	Setup    []*SuiteStep `yaml:"setup"`
+	Tests    []*SuiteTest `yaml:"tests"`
+	Teardown []*SuiteStep `yaml:"teardown"`
+
+	file string
+	jar  http.CookieJar
+	// session is the -session shared by the requests, saved with the cookies after the suite.
+	session       *Session
+	saveCookieJar func()
+}
+
+// SuiteVars are the suite variables in the declaration order, so that a variable can reference the former ones.
+type SuiteVars [][2]string
+
+// UnmarshalYAML implements yaml.Unmarshaler, keeping the order of the keys in the mapping.
+func (v *SuiteVars) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: vars should be a mapping", node.Line)
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		var value string
+		if err := node.Content[i+1].Decode(&value); err != nil {
+			return err
+		}
+		*v = append(*v, [2]string{node.Content[i].Value, value})
+	}
+	return nil
+}
+
+// SuiteStep is one request in the suite.
+type SuiteStep struct {
+	Name string `yaml:"name"`
+	// Request is in the gurl command line syntax: [METHOD] URL [ITEM [ITEM]].
+	Request string `yaml:"request"`
+	// Body is the raw request body, @file to load from the file.
+	Body string `yaml:"body"`
+	// Extract maps the variable name to the extract expression, same as -extract.
+	Extract map[string]string `yaml:"extract"`
+	// Expect is the expectations, same as -expect.
+	Expect []string `yaml:"expect"`
+
+	method, url string
+	items       []string
+	extractors  []*Extractor
+	expects     []*Expectation
+}
+
+// SuiteTest is a test case with a single request, or multiple steps sharing the variables extracted.
+type SuiteTest struct {
+	SuiteStep `yaml:",inline"`
+	Tags      []string     `yaml:"tags"`
+	Skip      bool         `yaml:"skip"`
+	Steps     []*SuiteStep `yaml:"steps"`
+}
+
+// LoadSuite loads the suite from the YAML file.
+func LoadSuite(file string) (*Suite, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Suite{file: file}
+	if err := yaml.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+
+	if s.Name == "" {
+		s.Name = file
+	}
+
+	for i, step := range s.Setup {
+		if err := step.parse(fmt.Sprintf("setup %d", i+1)); err != nil {
+			return nil, err
+		}
+	}
+	for i, step := range s.Teardown {
+		if err := step.parse(fmt.Sprintf("teardown %d", i+1)); err != nil {
+			return nil, err
+		}
+	}
+	for i, t := range s.Tests {
+		if t.Name == "" {
+			t.Name = fmt.Sprintf("test %d", i+1)
+		}
+		if len(t.Steps) == 0 {
+			t.Steps = []*SuiteStep{&t.SuiteStep}
+		} else if t.Request != "" || t.Body != "" || len(t.Extract) > 0 || len(t.Expect) > 0 {
+			return nil, fmt.Errorf("%s: request, body, extract and expect should be in the steps when steps are given", t.Name)
+		}
+		for j, step := range t.Steps {
+			if err := step.parse(fmt.Sprintf("%s step %d", t.Name, j+1)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// parse parses the request line, the extractors and the expectations of the step.
+func (p *SuiteStep) parse(defaultName string) error {
+	if p.Name == "" {
+		p.Name = defaultName
+	}
+
+	args, err := shellwords.Parse(p.Request)
+	if err != nil {
+		return fmt.Errorf("%s: bad request %q: %w", p.Name, p.Request, err)
+	}
+
+	if len(args) > 0 && inSlice(strings.ToUpper(args[0]), methodList) {
+		p.method, args = strings.ToUpper(args[0]), args[1:]
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("%s: request URL is missing", p.Name)
+	}
+	p.url, p.items = args[0], args[1:]
+
+	if p.method == "" {
+		p.method = "GET"
+		if p.Body != "" || hasDataItems(p.items) {
+			p.method = "POST"
+		}
+	}
+
+	for name, expr := range p.Extract {
+		e, err := ParseExtractor(name + "=" + expr)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.Name, err)
+		}
+		p.extractors = append(p.extractors, e)
+	}
+	sort.Slice(p.extractors, func(i, j int) bool { return p.extractors[i].Name < p.extractors[j].Name })
+
+	for _, spec := range p.Expect {
+		e, err := ParseExpectation(spec)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.Name, err)
+		}
+		p.expects = append(p.expects, e)
+	}
+
+	return nil
+}
+
+// hasDataItems tells whether there are request data items, which make the method defaults to POST.
+func hasDataItems(items []string) bool {
+	for _, item := range items {
+		if subs := keyReg.FindStringSubmatch(item); len(subs) > 0 {
+			switch subs[2] {
+			case "=", ":=", "@":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// selected tells whether the test is selected by the tags filter like smoke,!slow.
+func (t *SuiteTest) selected(tags []string) bool {
+	included, hasIncluded := false, false
+	for _, tag := range tags {
+		if exclude := strings.TrimPrefix(tag, "!"); exclude != tag {
+			if inSlice(exclude, t.Tags) {
+				return false
+			}
+			continue
+		}
+		hasIncluded = true
+		if inSlice(tag, t.Tags) {
+			included = true
+		}
+	}
+
+	return !hasIncluded || included
+}
+
+// Result status of the test cases.
+const (
+	StatusPassed  = "passed"
+	StatusFailed  = "failed"
+	StatusError   = "error"
+	StatusSkipped = "skipped"
+)
+
+// StepResult is the result of a step.
+type StepResult struct {
+	Name     string   `json:"name"`
+	Method   string   `json:"method"`
+	URL      string   `json:"url"`
+	Status   int      `json:"status,omitempty"`
+	Seconds  float64  `json:"seconds"`
+	Failures []string `json:"failures,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// CaseResult is the result of a test, or a setup/teardown step.
+type CaseResult struct {
+	Name    string       `json:"name"`
+	Phase   string       `json:"phase"` // setup, test or teardown
+	Tags    []string     `json:"tags,omitempty"`
+	Status  string       `json:"status"`
+	Reason  string       `json:"reason,omitempty"`
+	Seconds float64      `json:"seconds"`
+	Steps   []StepResult `json:"steps,omitempty"`
+}
+
+// SuiteResult is the result of a suite.
+type SuiteResult struct {
+	Name      string       `json:"name"`
+	File      string       `json:"file"`
+	Timestamp time.Time    `json:"timestamp"`
+	Seconds   float64      `json:"seconds"`
+	Tests     int          `json:"tests"`
+	Passed    int          `json:"passed"`
+	Failed    int          `json:"failed"`
+	Errors    int          `json:"errors"`
+	Skipped   int          `json:"skipped"`
+	Cases     []CaseResult `json:"cases"`
+}
+
+// withVars evaluates by the valuer with the variables, which are shared by the requests built in parallel.
+func withVars(vars map[string]string, f func()) {
+	valuerLock.Lock()
+	defer valuerLock.Unlock()
+
+	defer func(old map[string]string) {
+		valuer.Vars = old
+		valuer.ClearCache()
+	}(valuer.Vars)
+	valuer.Vars = vars
+	valuer.ClearCache()
+
+	f()
+}
+
+// buildRequest builds the request of the step with the variables in the scope,
+// with the auth, session, cookie jar and transport flags applied like the command line.
+func (s *Suite) buildRequest(p *SuiteStep, scope map[string]string) (*Request, error) {
+	var req *Request
+	var socket, realURL string
+	var err error
+	withVars(scope, func() {
+		var fixedURL string
+		socket, fixedURL = parseUnixSocketURL(Eval(p.url))
+		u := rest.FixURI(fixedURL, rest.WithDefaultScheme(ss.If(caFile != "", "https", "http")))
+		if err = u.Err; err != nil {
+			return
+		}
+		realURL = u.Data.String()
+
+		req = getHTTP(p.method, realURL, p.items, timeout)
+		if p.Body != "" {
+			req.Body(p.Body)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the signers set up below evaluate by the valuer too, so they are out of withVars.
+	req.DumpRequest(false)
+	req.Setting.UnixSocket = ss.Or(socket, unixSocket)
+	if auth != "" {
+		setupAuth(req)
+	}
+	if err := s.setupJar(req); err != nil {
+		return nil, err
+	}
+	if s.session != nil {
+		s.session.applyHeaders(req)
+	}
+	req.Jar = s.jar
+
+	req.SetTLSClientConfig(createTLSConfig(strings.HasPrefix(realURL, "https://")))
+	setupProxy(req)
+
+	setupTransport(req)
+	req.BuildURL()
+	return req, nil
+}
+
+// setupJar sets up the cookie jar shared by the requests of the suite once by the first request,
+// backed by the -session and the -cookie-jar if given, which are saved by saveJar after the suite.
+func (s *Suite) setupJar(req *Request) error {
+	if s.jar != nil {
+		return nil
+	}
+
+	req.Jar, _ = cookiejar.New(nil)
+	if session != "" {
+		sess, err := LoadSession(session, req.Req.URL.Host)
+		if err != nil {
+			return fmt.Errorf("load session %s: %w", session, err)
+		}
+		s.session, req.Jar = sess, sess.NewJar()
+	}
+	if cookieJar != "" {
+		s.saveCookieJar = setupCookieJar(cookieJar, req)
+	}
+	s.jar = req.Jar
+	return nil
+}
+
+// saveJar saves the cookies to the -session and the -cookie-jar.
+func (s *Suite) saveJar() {
+	if s.session != nil {
+		if err := s.session.Save(); err != nil {
+			log.Printf("save session %s: %v", s.session.file, err)
+		}
+	}
+	if s.saveCookieJar != nil {
+		s.saveCookieJar()
+	}
+}
+
+// runStep runs the step, the extracted variables are saved into the scope.
+func (s *Suite) runStep(p *SuiteStep, scope map[string]string) (r StepResult) {
+	r.Name, r.Method = p.Name, p.method
+
+	r.URL = p.url
+	req, err := s.buildRequest(p, scope)
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	r.URL = req.Req.URL.String()
+
+	if timeout > 0 {
+		ctx, cancel := context.WithTimeout(req.Req.Context(), timeout)
+		defer cancel()
+		req.Req = req.Req.WithContext(ctx)
+	}
+
+	start := time.Now()
+	defer func() { r.Seconds = time.Since(start).Seconds() }()
+
+	res, err := req.Response()
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	body, err := req.Bytes()
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	latency := time.Since(start)
+	r.URL, r.Status = req.Req.URL.String(), res.StatusCode
+	if s.session != nil {
+		s.session.Update(req)
+	}
+
+	for _, e := range p.expects {
+		if x := e.Check(res, body, latency); x.Failed {
+			r.Failures = append(r.Failures, fmt.Sprintf("expect %s, expected: %s, actual: %s", e.Spec, x.Expected(), x.Abbr()))
+		}
+	}
+
+	for _, e := range p.extractors {
+		v, ok := e.Extract(res.Header, body)
+		if !ok {
+			r.Failures = append(r.Failures, fmt.Sprintf("extract %s by %s:%s: not found", e.Name, e.Kind, e.Expr))
+			continue
+		}
+		scope[e.Name] = v
+	}
+
+	return r
+}
+
+// runSteps runs the steps in order, stops at the first failed one.
+func (s *Suite) runSteps(c *CaseResult, steps []*SuiteStep, scope map[string]string) {
+	start := time.Now()
+	c.Status = StatusPassed
+	for _, p := range steps {
+		r := s.runStep(p, scope)
+		c.Steps = append(c.Steps, r)
+		if r.Error != "" {
+			c.Status, c.Reason = StatusError, r.Name+": "+r.Error
+			break
+		}
+		if len(r.Failures) > 0 {
+			c.Status, c.Reason = StatusFailed, r.Name+": "+r.Failures[0]
+			break
+		}
+	}
+	c.Seconds = time.Since(start).Seconds()
+}
+
+// Run runs the setup steps, the selected tests with the parallelism, and then the teardown steps.
+func (s *Suite) Run(tags []string, parallel int) *SuiteResult {
+	result := &SuiteResult{Name: s.Name, File: s.file, Timestamp: time.Now()}
+	defer s.saveJar()
+
+	vars := map[string]string{}
+	for k, v := range valuer.Vars {
+		vars[k] = v
+	}
+	withVars(vars, func() {
+		for _, kv := range s.Vars {
+			vars[kv[0]] = Eval(kv[1])
+		}
+	})
+
+	fmt.Printf("%s %s\n", Color("suite:", Cyan), s.Name)
+
+	var out sync.Mutex
+	report := func(c CaseResult) {
+		out.Lock()
+		defer out.Unlock()
+		printCaseResult(c)
+	}
+
+	setupFailed := ""
+	for _, p := range s.Setup {
+		c := CaseResult{Name: p.Name, Phase: "setup"}
+		s.runSteps(&c, []*SuiteStep{p}, vars)
+		report(c)
+		result.Cases = append(result.Cases, c)
+		if c.Status != StatusPassed {
+			setupFailed = "setup " + p.Name + " " + c.Status
+			break
+		}
+	}
+
+	if parallel <= 0 {
+		parallel = s.Parallel
+	}
+	if parallel <= 0 {
+		parallel = 1
+	}
+
+	cases := make([]CaseResult, len(s.Tests))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, t := range s.Tests {
+		c := &cases[i]
+		c.Name, c.Phase, c.Tags = t.Name, "test", t.Tags
+
+		switch {
+		case t.Skip:
+			c.Status, c.Reason = StatusSkipped, "skip"
+		case !t.selected(tags):
+			c.Status, c.Reason = StatusSkipped, "not selected by tags"
+		case setupFailed != "":
+			c.Status, c.Reason = StatusSkipped, setupFailed
+		}
+		if c.Status != "" {
+			report(*c)
+			continue
+		}
+
+		scope := make(map[string]string, len(vars))
+		for k, v := range vars {
+			scope[k] = v
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(t *SuiteTest) {
+			defer func() { <-sem; wg.Done() }()
+			s.runSteps(c, t.Steps, scope)
+			report(*c)
+		}(t)
+	}
+	wg.Wait()
+	result.Cases = append(result.Cases, cases...)
+
+	for _, p := range s.Teardown {
+		c := CaseResult{Name: p.Name, Phase: "teardown"}
+		s.runSteps(&c, []*SuiteStep{p}, vars)
+		report(c)
+		result.Cases = append(result.Cases, c)
+	}
+
+	for _, c := range result.Cases {
+		result.Tests++
+		switch c.Status {
+		case StatusPassed:
+			result.Passed++
+		case StatusFailed:
+			result.Failed++
+		case StatusError:
+			result.Errors++
+		case StatusSkipped:
+			result.Skipped++
+		}
+	}
+	result.Seconds = time.Since(result.Timestamp).Seconds()
+
+	return result
+}
+
+func printCaseResult(c CaseResult) {
+	name := c.Name
+	if c.Phase != "test" {
+		name = c.Phase + ": " + name
+	}
+	cost := time.Duration(c.Seconds * float64(time.Second)).Round(time.Millisecond)
+
+	switch c.Status {
+	case StatusPassed:
+		fmt.Printf("  %s %s %s\n", Color("PASS", Green), name, Color(cost.String(), Gray))
+	case StatusSkipped:
+		fmt.Printf("  %s %s %s\n", Color("SKIP", Yellow), name, Color(c.Reason, Gray))
+	default:
+		fmt.Printf("  %s %s %s\n", Color(strings.ToUpper(c.Status), Red), name, Color(cost.String(), Gray))
+		for _, r := range c.Steps {
+			if r.Error == "" && len(r.Failures) == 0 {
+				continue
+			}
+			fmt.Printf("       %s %s %s\n", r.Name, r.Method, Color(r.URL, Gray))
+			if r.Error != "" {
+				fmt.Printf("         %s\n", Color(r.Error, Red))
+			}
+			for _, f := range r.Failures {
+				fmt.Printf("         %s\n", Color(f, Red))
+			}
+		}
+	}
+
+	if HasPrintOption(printVerbose) {
+		for _, r := range c.Steps {
+			log.Printf("%s: %s %s => %d, cost %.3fs", r.Name, r.Method, r.URL, r.Status, r.Seconds)
+		}
+	}
+}
+
+// junitTestSuites is the root of the JUnit XML report.
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnitReport writes the results as JUnit XML report.
+func writeJUnitReport(file string, results []*SuiteResult) error {
+	var root junitTestSuites
+	for _, r := range results {
+		ts := junitTestSuite{
+			Name: r.Name, Tests: r.Tests, Failures: r.Failed, Errors: r.Errors, Skipped: r.Skipped,
+			Time:      fmt.Sprintf("%.3f", r.Seconds),
+			Timestamp: r.Timestamp.Format("2006-01-02T15:04:05"),
+		}
+		for _, c := range r.Cases {
+			tc := junitTestCase{Name: c.Name, Classname: r.Name + "." + c.Phase, Time: fmt.Sprintf("%.3f", c.Seconds)}
+			var details []string
+			for _, s := range c.Steps {
+				details = append(details, fmt.Sprintf("%s: %s %s => %d", s.Name, s.Method, s.URL, s.Status))
+				if s.Error != "" {
+					details = append(details, "  "+s.Error)
+				}
+				for _, f := range s.Failures {
+					details = append(details, "  "+f)
+				}
+			}
+			m := &junitMessage{Message: c.Reason, Text: strings.Join(details, "\n")}
+			switch c.Status {
+			case StatusFailed:
+				tc.Failure = m
+			case StatusError:
+				tc.Error = m
+			case StatusSkipped:
+				tc.Skipped = &junitMessage{Message: c.Reason}
+			}
+			ts.Cases = append(ts.Cases, tc)
+		}
+		root.Suites = append(root.Suites, ts)
+	}
+
+	data, err := xml.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append([]byte(xml.Header), data...), 0o644)
+}
+
+// writeJSONReport writes the results as JSON report.
+func writeJSONReport(file string, results []*SuiteResult) error {
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0o644)
+}
+
+// runTestSuites runs the suite files, prints the summary and writes the reports, returns the exit code.
+func runTestSuites(files []string) int {
+	if len(files) == 0 {
+		log.Fatalf("usage: gurl test [-tags smoke,!slow] [-parallel 4] [-junit report.xml] [-report report.json] suite.yaml...")
+	}
+
+	// the variables in the suite should never be asked from the terminal.
+	valuer.InteractiveMode = false
+
+	var tags []string
+	for _, tag := range strings.Split(testTags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	var results []*SuiteResult
+	total := &SuiteResult{Timestamp: time.Now()}
+	for _, file := range files {
+		s, err := LoadSuite(file)
+		if err != nil {
+			log.Fatalf("load suite %s: %v", file, err)
+		}
+
+		r := s.Run(tags, testParallel)
+		results = append(results, r)
+		total.Tests += r.Tests
+		total.Passed += r.Passed
+		total.Failed += r.Failed
+		total.Errors += r.Errors
+		total.Skipped += r.Skipped
+	}
+
+	summary := fmt.Sprintf("total: %d, passed: %d, failed: %d, errors: %d, skipped: %d, cost: %s",
+		total.Tests, total.Passed, total.Failed, total.Errors, total.Skipped, time.Since(total.Timestamp).Round(time.Millisecond))
+	if total.Failed+total.Errors > 0 {
+		fmt.Println(Color(summary, Red))
+	} else {
+		fmt.Println(Color(summary, Green))
+	}
+
+	if testJUnit != "" {
+		if err := writeJUnitReport(testJUnit, results); err != nil {
+			log.Fatalf("write JUnit report %s: %v", testJUnit, err)
+		}
+	}
+	if testReport != "" {
+		if err := writeJSONReport(testReport, results); err != nil {
+			log.Fatalf("write JSON report %s: %v", testReport, err)
+		}
+	}
+
+	if total.Failed+total.Errors > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadSuite(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "suite.yaml")
+	data := `
+name: demo
+tests:
+  - name: single
+    tags: [smoke]
+    request: :8080/users Authorization:"Bearer @token"
+    expect: [status=200]
+  - steps:
+      - request: :8080/users name=bob
+        extract: {id: data.id}
+      - request: DELETE :8080/users/@id
+`
+	if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := LoadSuite(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	single := s.Tests[0].Steps[0]
+	if single.method != "GET" || single.url != ":8080/users" || len(single.items) != 1 ||
+		single.items[0] != "Authorization:Bearer @token" || len(single.expects) != 1 {
+		t.Errorf("bad single step: %+v", single)
+	}
+
+	steps := s.Tests[1].Steps
+	if s.Tests[1].Name != "test 2" || len(steps) != 2 {
+		t.Fatalf("bad multiple steps test: %+v", s.Tests[1])
+	}
+	if steps[0].method != "POST" || len(steps[0].extractors) != 1 || steps[1].method != "DELETE" {
+		t.Errorf("bad steps: %+v, %+v", steps[0], steps[1])
+	}
+}
+
+func TestSuiteTestSelected(t *testing.T) {
+	test := &SuiteTest{Tags: []string{"smoke", "slow"}}
+	cases := []struct {
+		tags []string
+		want bool
+	}{
+		{nil, true},
+		{[]string{"smoke"}, true},
+		{[]string{"users"}, false},
+		{[]string{"users", "smoke"}, true},
+		{[]string{"!slow"}, false},
+		{[]string{"!fast"}, true},
+	}
+	for _, c := range cases {
+		if got := test.selected(c.tags); got != c.want {
+			t.Errorf("selected(%v) = %t, want %t", c.tags, got, c.want)
+		}
+	}
+}
+
+func TestLoadSuiteRequestWithSteps(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "suite.yaml")
+	data := `
+tests:
+  - request: :8080/ignored
+    steps:
+      - request: :8080/users
+`
+	if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSuite(file); err == nil || !strings.Contains(err.Error(), "should be in the steps") {
+		t.Errorf("LoadSuite should reject request with steps, got %v", err)
+	}
+}
+
+func TestSuiteRunAuthSession(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "u" || pass != "p" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "s1", Path: "/"})
+			return
+		}
+		if c, err := r.Cookie("sid"); err != nil || c.Value != "s1" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "suite.yaml")
+	data := `
+setup:
+  - request: ` + ts.URL + `/login X-Tenant:t1
+tests:
+  - request: ` + ts.URL + `/users
+    expect: [status=200]
+`
+	if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadSuite(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	savedAuth, savedSession := auth, session
+	defer func() { auth, session = savedAuth, savedSession }()
+	auth, session = "u:p", filepath.Join(dir, "session.json")
+
+	if r := s.Run(nil, 1); r.Passed != 2 {
+		t.Errorf("suite result: %+v", r.Cases)
+	}
+
+	sess, err := LoadSession(session, "")
+	if err != nil || len(sess.Cookies) != 1 || sess.Cookies[0].Value != "s1" {
+		t.Errorf("saved session: %+v, %v", sess, err)
+	}
+	if sess.Headers["X-Tenant"] != "t1" || !strings.HasPrefix(sess.Auth, "Basic ") {
+		t.Errorf("saved session headers %v, auth %q", sess.Headers, sess.Auth)
+	}
+}
+
+func TestSuiteRunVarsParallel(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/x" || !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	// base references host declared before it, the tests run in parallel with a JWT minted for every request.
+	data := "vars:\n  host: " + ts.URL + "\n  base: \"@host/api\"\nparallel: 4\ntests:\n"
+	for i := 0; i < 8; i++ {
+		data += "  - request: \"@base/x\"\n    expect: [status=200]\n"
+	}
+	file := filepath.Join(t.TempDir(), "suite.yaml")
+	if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadSuite(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Vars) != 2 || s.Vars[0][0] != "host" || s.Vars[1][0] != "base" {
+		t.Fatalf("vars should keep the declaration order: %v", s.Vars)
+	}
+
+	savedClaims, savedKey := jwtClaims, jwtKey
+	defer func() { jwtClaims, jwtKey = savedClaims, savedKey }()
+	jwtClaims, jwtKey = `{"jti":"@uuid"}`, "secret:k"
+
+	globalVars := valuer.Vars
+	if r := s.Run(nil, 0); r.Passed != 8 {
+		t.Errorf("suite result: %+v", r.Cases)
+	}
+	if _, ok := valuer.Vars["host"]; ok || reflect.ValueOf(valuer.Vars).Pointer() != reflect.ValueOf(globalVars).Pointer() {
+		t.Errorf("valuer vars are not restored: %v", valuer.Vars)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+func main() {
+	req, err := http.NewRequest("POST", "http://a.b/x?q=1&name=o'neil", strings.NewReader("\x89PNG\r\n\x00\xff'%\\\"\n"))
+	if err != nil {
+		panic(err)
+	}
+	req.Host = "c.d"
+	req.Header.Add("Content-Type", "application/octet-stream")
+	req.Header.Add("X-Name", "it's me")
+
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		panic(err)
+	}
+	defer rsp.Body.Close()
+
+	data, _ := io.ReadAll(rsp.Body)
+	fmt.Println(rsp.Status)
+	fmt.Println(string(data))
+}
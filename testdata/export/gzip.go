@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+func main() {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(`hello 'gzip'
+bye`))
+	zw.Close()
+
+	req, err := http.NewRequest("POST", "http://a.b/x?q=1&name=o'neil", &buf)
+	if err != nil {
+		panic(err)
+	}
+	req.Host = "c.d"
+	req.Header.Add("Content-Encoding", "gzip")
+	req.Header.Add("Content-Type", "text/plain")
+	req.Header.Add("X-Name", "it's me")
+
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		panic(err)
+	}
+	defer rsp.Body.Close()
+
+	data, _ := io.ReadAll(rsp.Body)
+	fmt.Println(rsp.Status)
+	fmt.Println(string(data))
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+func main() {
+	req, err := http.NewRequest("POST", "http://a.b/x?q=1&name=o'neil", strings.NewReader("--gurl-boundary\r\nContent-Disposition: form-data; name=\"name\"\r\n\r\nbob\r\n--gurl-boundary\r\nContent-Disposition: form-data; name=\"file\"; filename=\"a.txt\"\r\nContent-Type: application/octet-stream\r\n\r\nit's a file\n\r\n--gurl-boundary--\r\n"))
+	if err != nil {
+		panic(err)
+	}
+	req.Host = "c.d"
+	req.Header.Add("Content-Type", "multipart/form-data; boundary=gurl-boundary")
+	req.Header.Add("X-Name", "it's me")
+
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		panic(err)
+	}
+	defer rsp.Body.Close()
+
+	data, _ := io.ReadAll(rsp.Body)
+	fmt.Println(rsp.Status)
+	fmt.Println(string(data))
+}
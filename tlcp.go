@@ -1,14 +1,24 @@
 package main
 
 import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"log"
 	"net"
+	"net/url"
 	"os"
 	"strings"
+	"sync"
 
 	"gitee.com/Trisia/gotlcp/tlcp"
 	"github.com/bingoohuang/gg/pkg/osx"
 	"github.com/bingoohuang/gg/pkg/osx/env"
+	"github.com/bingoohuang/gg/pkg/ss"
+	"github.com/emmansun/gmsm/pkcs8"
 	"github.com/emmansun/gmsm/smx509"
 )
 
@@ -20,63 +30,171 @@ func init() {
 	}
 }
 
-var tlcpCerts = os.Getenv("TLCP_CERTS")
+var (
+	tlcpKeyLogWarning sync.Once
+
+	tlcpConfigOnce sync.Once
+	tlcpConfig     *tlcp.Config
+)
 
 func createTlcpDialer(dialer *net.Dialer, caFile string) DialContextFn {
+	tlcpConfigOnce.Do(func() { tlcpConfig = createTlcpConfig(caFile) })
+
+	d := tlcp.Dialer{NetDialer: dialer, Config: tlcpConfig}
+	return d.DialContext
+}
+
+// createTlcpConfig creates the TLCP config with the CA bundle, the client sign/enc certificates and the cipher suites.
+func createTlcpConfig(caFile string) *tlcp.Config {
 	c := &tlcp.Config{
 		InsecureSkipVerify: !env.Bool(`TLS_VERIFY`, false),
 		SessionCache:       tlcpSessionCache,
 	}
 
 	c.EnableDebug = HasPrintOption(printDebug)
+	c.ServerName = tlsSNI
+	if keyLogFile != "" {
+		// gotlcp has no key log writer in its config, and Wireshark can not decrypt TLCP anyway.
+		tlcpKeyLogWarning.Do(func() { log.Printf("-keylog/SSLKEYLOGFILE is not supported for TLCP, ignored") })
+	}
 
 	if caFile != "" {
-		rootCert, err := smx509.ParseCertificatePEM(osx.ReadFile(caFile, osx.WithFatalOnError(true)).Data)
-		if err != nil {
-			panic(err)
-		}
 		pool := smx509.NewCertPool()
-		pool.AddCert(rootCert)
+		if !pool.AppendCertsFromPEM(osx.ReadFile(caFile, osx.WithFatalOnError(true)).Data) {
+			log.Fatalf("no CA certificates found in %s", caFile)
+		}
 		c.RootCAs = pool
 	}
 
 	if tlcpCerts != "" {
-		// TLCP 1.1，套件ECDHE-SM2-SM4-CBC-SM3，设置客户端双证书
-		certsFiles := strings.Split(tlcpCerts, ",")
-		var certs []tlcp.Certificate
-		switch len(certsFiles) {
-		case 0, 2, 4:
-		default:
-			panic("-tclp-certs should be sign.cert.pem,sign.key.pem,enc.cert.pem,enc.key.pem")
+		certs, err := loadTLCPCertificates(tlcpCerts, readCredentials(tlcpKeyPass))
+		if err != nil {
+			log.Fatalf("TLCP_CERTS: %v", err)
 		}
-		if len(certs) >= 2 {
-			signCertKeypair, err := tlcp.X509KeyPair(osx.ReadFile(certsFiles[0], osx.WithFatalOnError(true)).Data,
-				osx.ReadFile(certsFiles[1], osx.WithFatalOnError(true)).Data)
-			if err != nil {
-				panic(err)
-			}
-			certs = append(certs, signCertKeypair)
+		c.Certificates = certs
+	}
+
+	suites, err := parseTLCPSuites(tlcpSuites, len(c.Certificates) > 1)
+	if err != nil {
+		log.Fatalf("-tlcp-suites: %v", err)
+	}
+	c.CipherSuites = suites
+
+	return c
+}
+
+// loadTLCPCertificates loads the client sign and the optional enc certificates by sign.cert,sign.key[,enc.cert,enc.key].
+func loadTLCPCertificates(spec, password string) ([]tlcp.Certificate, error) {
+	files := strings.Split(spec, ",")
+	if len(files) != 2 && len(files) != 4 {
+		return nil, errors.New("should be sign.cert.pem,sign.key.pem[,enc.cert.pem,enc.key.pem]")
+	}
+
+	var certs []tlcp.Certificate
+	for i := 0; i < len(files); i += 2 {
+		cert, err := loadTLCPKeyPair(strings.TrimSpace(files[i]), strings.TrimSpace(files[i+1]), password)
+		if err != nil {
+			return nil, err
 		}
-		if len(certs) >= 4 {
-			encCertKeypair, err := tlcp.X509KeyPair(osx.ReadFile(certsFiles[2], osx.WithFatalOnError(true)).Data,
-				osx.ReadFile(certsFiles[3], osx.WithFatalOnError(true)).Data)
-			if err != nil {
-				panic(err)
-			}
-			certs = append(certs, encCertKeypair)
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// loadTLCPKeyPair loads the certificate, with the chain following it in the same file, and its private key,
+// which can be the encrypted PKCS#8 one with the password.
+func loadTLCPKeyPair(certFile, keyFile, password string) (tlcp.Certificate, error) {
+	var cert tlcp.Certificate
+
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return cert, err
+	}
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "CERTIFICATE" {
+			cert.Certificate = append(cert.Certificate, block.Bytes)
+		}
+	}
+	if len(cert.Certificate) == 0 {
+		return cert, fmt.Errorf("no certificate found in %s", certFile)
+	}
+	if cert.Leaf, err = smx509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return cert, fmt.Errorf("parse certificate %s: %w", certFile, err)
+	}
+
+	if data, err = os.ReadFile(keyFile); err != nil {
+		return cert, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return cert, fmt.Errorf("no private key found in %s", keyFile)
+	}
+
+	switch block.Type {
+	case "ENCRYPTED PRIVATE KEY":
+		if password == "" {
+			return cert, fmt.Errorf("private key %s is encrypted, the password is required by -tlcp-pass", keyFile)
 		}
+		cert.PrivateKey, err = pkcs8.ParsePKCS8PrivateKey(block.Bytes, []byte(password))
+	default:
+		cert.PrivateKey, err = parsePrivateKey(block)
+	}
+	if err != nil {
+		return cert, fmt.Errorf("parse private key %s: %w", keyFile, err)
+	}
 
-		if len(certs) > 0 {
-			c.Certificates = certs
-			c.CipherSuites = []uint16{tlcp.ECDHE_SM4_CBC_SM3, tlcp.ECDHE_SM4_GCM_SM3}
+	type publicKey interface{ Equal(crypto.PublicKey) bool }
+	if k, ok := cert.PrivateKey.(crypto.Signer); ok {
+		if pub, ok := k.Public().(publicKey); ok && !pub.Equal(cert.Leaf.PublicKey) {
+			return cert, fmt.Errorf("private key %s does not match the certificate %s", keyFile, certFile)
 		}
 	}
 
-	d := tlcp.Dialer{NetDialer: dialer, Config: c}
-	return d.DialContext
+	return cert, nil
+}
+
+var tlcpSuiteNames = map[string]uint16{
+	"ECC_SM4_CBC_SM3": tlcp.ECC_SM4_CBC_SM3, "ECC_SM4_GCM_SM3": tlcp.ECC_SM4_GCM_SM3,
+	"ECDHE_SM4_CBC_SM3": tlcp.ECDHE_SM4_CBC_SM3, "ECDHE_SM4_GCM_SM3": tlcp.ECDHE_SM4_GCM_SM3,
+}
+
+// parseTLCPSuites parses the cipher suites, ecc, ecdhe, or the names like ECC_SM4_GCM_SM3,ECDHE_SM4_CBC_SM3.
+// The ECDHE suites require the client enc certificate, and are preferred by default when it is present.
+func parseTLCPSuites(s string, hasEncCert bool) ([]uint16, error) {
+	ecc := []uint16{tlcp.ECC_SM4_GCM_SM3, tlcp.ECC_SM4_CBC_SM3}
+	ecdhe := []uint16{tlcp.ECDHE_SM4_GCM_SM3, tlcp.ECDHE_SM4_CBC_SM3}
+
+	var suites []uint16
+	switch strings.ToLower(s) {
+	case "":
+		if hasEncCert {
+			return append(ecdhe, ecc...), nil
+		}
+		return nil, nil
+	case "ecc":
+		suites = ecc
+	case "ecdhe":
+		suites = ecdhe
+	default:
+		for _, name := range splitList(s) {
+			id, ok := tlcpSuiteNames[strings.ToUpper(name)]
+			if !ok {
+				return nil, fmt.Errorf("unknown TLCP cipher suite %s", name)
+			}
+			suites = append(suites, id)
+		}
+	}
+
+	for _, id := range suites {
+		if !hasEncCert && (id == tlcp.ECDHE_SM4_CBC_SM3 || id == tlcp.ECDHE_SM4_GCM_SM3) {
+			return nil, errors.New("ECDHE suites require the client sign and enc certificates in TLCP_CERTS")
+		}
+	}
+	return suites, nil
 }
 
 func printTLCPConnectState(state tlcp.ConnectionState) {
+	printPeerCertificates("TLCP", state.PeerCertificates)
 	if !HasPrintOption(printRspOption) {
 		return
 	}
@@ -90,7 +208,93 @@ func printTLCPConnectState(state tlcp.ConnectionState) {
 		}
 	}(state.Version)
 	fmt.Printf("option TLCP.Version: %s\n", tlsVersion)
+	fmt.Printf("option TLCP.CipherSuite: %s\n", tlcp.CipherSuiteName(state.CipherSuite))
+	for i, c := range state.PeerCertificates {
+		if i < 2 {
+			fmt.Printf("option TLCP.Server%sCert: subject %s, issuer %s\n", tlcpCertRoles[i], c.Subject, c.Issuer)
+		}
+	}
+	if tlcpConfig != nil {
+		for i, c := range tlcpConfig.Certificates {
+			fmt.Printf("option TLCP.Client%sCert: subject %s, issuer %s, not after %s\n",
+				tlcpCertRoles[i], c.Leaf.Subject, c.Leaf.Issuer, c.Leaf.NotAfter.Format("2006-01-02"))
+		}
+	}
 	fmt.Printf("option TLCP.HandshakeComplete: %t\n", state.HandshakeComplete)
 	fmt.Printf("option TLCP.DidResume: %t\n", state.DidResume)
 	fmt.Println()
 }
+
+var tlcpCertRoles = []string{"Sign", "Enc"}
+
+// tlsProtocols remembers the protocol, TLS or TLCP, detected by the -tlcp auto mode for each host:port.
+var tlsProtocols sync.Map
+
+// tlcpModeOf normalizes the -tlcp or $TLCP value to on, off or auto.
+func tlcpModeOf(s string) string {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "auto":
+		return "auto"
+	case "1", "t", "true", "on", "yes", "y":
+		return "on"
+	default:
+		return "off"
+	}
+}
+
+// createAutoTLSDialer creates the dialer which probes the server by TLS first and then TLCP,
+// and remembers the protocol which works for the address dialed.
+func createAutoTLSDialer(dialer *net.Dialer, tlsConfig *tls.Config) DialContextFn {
+	tlsDial := (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext
+	tlcpDial := createTlcpDialer(dialer, caFile)
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if p, ok := tlsProtocols.Load(addr); ok {
+			printAutoProtocol(addr, p.(string), "remembered")
+			if p == "TLCP" {
+				return tlcpDial(ctx, network, addr)
+			}
+			return tlsDial(ctx, network, addr)
+		}
+
+		conn, tlsErr := tlsDial(ctx, network, addr)
+		if tlsErr == nil {
+			tlsProtocols.Store(addr, "TLS")
+			printAutoProtocol(addr, "TLS", "detected")
+			return conn, nil
+		}
+
+		// no fallback when the server is unreachable, or it speaks TLS but the certificate is bad.
+		var opErr *net.OpError
+		var certErr *tls.CertificateVerificationError
+		if ctx.Err() != nil || errors.As(tlsErr, &certErr) || errors.As(tlsErr, &opErr) && opErr.Op == "dial" {
+			return nil, tlsErr
+		}
+
+		conn, tlcpErr := tlcpDial(ctx, network, addr)
+		if tlcpErr != nil {
+			return nil, fmt.Errorf("auto detect TLS/TLCP for %s failed, TLS: %v, TLCP: %w", addr, tlsErr, tlcpErr)
+		}
+
+		tlsProtocols.Store(addr, "TLCP")
+		printAutoProtocol(addr, "TLCP", "detected")
+		return conn, nil
+	}
+}
+
+func printAutoProtocol(hostPort, protocol, how string) {
+	if HasPrintOption(printRspOption) {
+		fmt.Printf("option Protocol: %s for %s (%s by -tlcp auto)\n", protocol, hostPort, how)
+	} else if HasPrintOption(printVerbose) {
+		log.Printf("protocol %s for %s, %s by -tlcp auto", protocol, hostPort, how)
+	}
+}
+
+// urlHostPort returns the host:port of the URL with the default port, the same as the address to dial.
+func urlHostPort(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = ss.If(u.Scheme == "https", "443", "80")
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
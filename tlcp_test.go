@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gitee.com/Trisia/gotlcp/tlcp"
+	"github.com/emmansun/gmsm/pkcs8"
+	"github.com/emmansun/gmsm/sm2"
+	"github.com/emmansun/gmsm/smx509"
+)
+
+func TestLoadTLCPKeyPair(t *testing.T) {
+	dir := t.TempDir()
+	key, _ := sm2.GenerateKey(rand.Reader)
+	tmpl := &smx509.Certificate{
+		SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "sign"},
+		NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour),
+	}
+	der, err := smx509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := pkcs8.MarshalPrivateKey(key, []byte("secret"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "sign.cert.pem"), filepath.Join(dir, "sign.key.pem")
+	_ = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	_ = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: keyDER}), 0o600)
+
+	if _, err := loadTLCPKeyPair(certFile, keyFile, ""); err == nil {
+		t.Error("encrypted key without password should fail")
+	}
+	if _, err := loadTLCPKeyPair(certFile, keyFile, "wrong"); err == nil {
+		t.Error("encrypted key with wrong password should fail")
+	}
+	cert, err := loadTLCPKeyPair(certFile, keyFile, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Leaf.Subject.CommonName != "sign" || len(cert.Certificate) != 1 {
+		t.Errorf("bad certificate %+v", cert.Leaf.Subject)
+	}
+	if _, ok := cert.PrivateKey.(*sm2.PrivateKey); !ok {
+		t.Errorf("bad private key %T", cert.PrivateKey)
+	}
+}
+
+func TestParseTLCPSuites(t *testing.T) {
+	if s, _ := parseTLCPSuites("", true); len(s) != 4 || s[0] != tlcp.ECDHE_SM4_GCM_SM3 {
+		t.Errorf("default suites with enc cert = %x", s)
+	}
+	if s, _ := parseTLCPSuites("", false); s != nil {
+		t.Errorf("default suites without enc cert = %x", s)
+	}
+	if s, _ := parseTLCPSuites("ecc_sm4_cbc_sm3", false); len(s) != 1 || s[0] != tlcp.ECC_SM4_CBC_SM3 {
+		t.Errorf("named suites = %x", s)
+	}
+	if _, err := parseTLCPSuites("ecdhe", false); err == nil {
+		t.Error("ECDHE without enc cert should fail")
+	}
+}
+
+func TestTLCPModeOf(t *testing.T) {
+	for s, want := range map[string]string{"": "off", "0": "off", "1": "on", "true": "on", "AUTO": "auto"} {
+		if got := tlcpModeOf(s); got != want {
+			t.Errorf("tlcpModeOf(%q) = %s, want %s", s, got, want)
+		}
+	}
+}
+
+func TestAutoTLSDialer(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+	addr := ts.Listener.Addr().String()
+	defer tlsProtocols.Delete(addr)
+
+	// the server certificate is not trusted, the verification error is returned without the TLCP fallback.
+	dial := createAutoTLSDialer(&net.Dialer{}, &tls.Config{ServerName: "example.com"})
+	var certErr *tls.CertificateVerificationError
+	if _, err := dial(context.Background(), "tcp", addr); !errors.As(err, &certErr) {
+		t.Fatalf("want the certificate verification error, got %v", err)
+	}
+	if p, ok := tlsProtocols.Load(addr); ok {
+		t.Fatalf("protocol %v should not be remembered on the verification error", p)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+	dial = createAutoTLSDialer(&net.Dialer{}, &tls.Config{RootCAs: pool, ServerName: "example.com"})
+	conn, err := dial(context.Background(), "tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if p, _ := tlsProtocols.Load(addr); p != "TLS" {
+		t.Fatalf("remembered protocol %v, want TLS", p)
+	}
+
+	// the remembered protocol is used for the address.
+	if conn, err = dial(context.Background(), "tcp", addr); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
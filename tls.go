@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bingoohuang/gg/pkg/ss"
+	"github.com/emmansun/gmsm/sm2"
+	"github.com/emmansun/gmsm/smx509"
+	"github.com/fatih/color"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// loadClientCertificate loads the client certificate for the mutual TLS from the PEM cert and key files,
+// the key can be in the cert file too, or from the PKCS#12 (.p12/.pfx) file with the password.
+func loadClientCertificate(certFile, keyFile, password string) (*tls.Certificate, error) {
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(certFile)) {
+	case ".p12", ".pfx":
+		key, cert, caCerts, err := pkcs12.DecodeChain(data, password)
+		if err != nil {
+			return nil, fmt.Errorf("decode PKCS#12 %s: %w", certFile, err)
+		}
+		return pkcs12Certificate(key, append([]*x509.Certificate{cert}, caCerts...))
+	}
+
+	keyData := data
+	if keyFile != "" {
+		if keyData, err = os.ReadFile(keyFile); err != nil {
+			return nil, err
+		}
+	}
+
+	cert, err := tls.X509KeyPair(data, keyData)
+	if err != nil {
+		return nil, fmt.Errorf("load client certificate %s: %w", certFile, err)
+	}
+	return &cert, nil
+}
+
+// pkcs12Certificate builds the certificate whose leaf is the one matching the private key, followed by the rest of the chain,
+// because the certificate bags in the PKCS#12 file can be in any order.
+func pkcs12Certificate(key interface{}, certs []*x509.Certificate) (*tls.Certificate, error) {
+	type publicKey interface{ Equal(crypto.PublicKey) bool }
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key %T", key)
+	}
+	pub, ok := signer.Public().(publicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported public key %T", signer.Public())
+	}
+
+	cert := &tls.Certificate{PrivateKey: key}
+	for _, c := range certs {
+		if cert.Leaf == nil && pub.Equal(c.PublicKey) {
+			cert.Leaf = c
+			cert.Certificate = append([][]byte{c.Raw}, cert.Certificate...)
+		} else {
+			cert.Certificate = append(cert.Certificate, c.Raw)
+		}
+	}
+	if cert.Leaf == nil {
+		return nil, fmt.Errorf("no certificate matches the private key")
+	}
+	return cert, nil
+}
+
+// setupClientCertificate sets the client certificate into the TLS config for the mutual TLS,
+// and prints the certificate requested by the server and the one sent under -po.
+func setupClientCertificate(c *tls.Config) {
+	var cert *tls.Certificate
+	if clientCert != "" {
+		var err error
+		if cert, err = loadClientCertificate(clientCert, clientKey, readCredentials(clientPass)); err != nil {
+			log.Fatalf("mtls: %v", err)
+		}
+	}
+
+	if cert == nil && !HasPrintOption(printRspOption) {
+		return
+	}
+
+	c.GetClientCertificate = func(cri *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		if HasPrintOption(printRspOption) {
+			printClientCertRequest(cri, cert)
+		}
+		if cert == nil {
+			return &tls.Certificate{}, nil
+		}
+		return cert, nil
+	}
+}
+
+func printClientCertRequest(cri *tls.CertificateRequestInfo, cert *tls.Certificate) {
+	var cas []string
+	for _, raw := range cri.AcceptableCAs {
+		var name pkix.RDNSequence
+		if _, err := asn1.Unmarshal(raw, &name); err == nil {
+			var n pkix.Name
+			n.FillFromRDNSequence(&name)
+			cas = append(cas, n.String())
+		}
+	}
+	if len(cas) == 0 {
+		cas = append(cas, "any")
+	}
+	fmt.Printf("option TLS.ClientCertRequested: acceptable CAs [%s]\n", strings.Join(cas, "; "))
+
+	if cert == nil || len(cert.Certificate) == 0 {
+		fmt.Printf("option TLS.ClientCertSent: none\n")
+		return
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		fmt.Printf("option TLS.ClientCertSent: unparsable certificate, %v\n", err)
+		return
+	}
+	fmt.Printf("option TLS.ClientCertSent: subject %s, issuer %s, not after %s\n",
+		leaf.Subject, leaf.Issuer, leaf.NotAfter.Format("2006-01-02"))
+	if err := cri.SupportsCertificate(cert); err != nil {
+		fmt.Printf("option TLS.ClientCertWarning: %v\n", err)
+	}
+}
+
+// printPeerCertificates prints the certificate chain sent by the server, the TLCP one starts with the sign and enc certificates.
+func printPeerCertificates(protocol string, certs []*smx509.Certificate) {
+	if !HasPrintOption(printPeerCerts) {
+		return
+	}
+
+	for i, c := range certs {
+		role := ""
+		if protocol == "TLCP" && i < 2 {
+			role = ss.If(i == 0, " (sign)", " (enc)")
+		}
+		fmt.Printf("option %s.PeerCertificate[%d]%s: %s\n", protocol, i, role, c.Subject)
+		fmt.Printf("  Issuer:       %s\n", c.Issuer)
+		if sans := certSANs(c); len(sans) > 0 {
+			fmt.Printf("  SANs:         %s\n", strings.Join(sans, ", "))
+		}
+		fmt.Printf("  Serial:       %X\n", c.SerialNumber)
+		fmt.Printf("  Validity:     %s ~ %s (%s)\n",
+			c.NotBefore.Format(time.RFC3339), c.NotAfter.Format(time.RFC3339), certExpiry(c.NotBefore, c.NotAfter))
+		fmt.Printf("  PublicKey:    %s\n", publicKeyType(c.PublicKey))
+		fmt.Printf("  Signature:    %s\n", c.SignatureAlgorithm)
+		fmt.Printf("  SPKI SHA256:  %s\n", spkiHash(c.RawSubjectPublicKeyInfo))
+	}
+	fmt.Println()
+}
+
+// x509Certificates converts the standard certificates to the smx509 ones, to be printed the same way as the TLCP ones.
+func x509Certificates(certs []*x509.Certificate) []*smx509.Certificate {
+	var result []*smx509.Certificate
+	for _, c := range certs {
+		if sc, err := smx509.ParseCertificate(c.Raw); err == nil {
+			result = append(result, sc)
+		}
+	}
+	return result
+}
+
+func certSANs(c *smx509.Certificate) []string {
+	var sans []string
+	for _, v := range c.DNSNames {
+		sans = append(sans, "DNS:"+v)
+	}
+	for _, v := range c.IPAddresses {
+		sans = append(sans, "IP:"+v.String())
+	}
+	for _, v := range c.EmailAddresses {
+		sans = append(sans, "email:"+v)
+	}
+	for _, v := range c.URIs {
+		sans = append(sans, "URI:"+v.String())
+	}
+	return sans
+}
+
+// certExpiry returns the days to expiry, highlighted in red when expired or within 7 days, in yellow within 30 days.
+func certExpiry(notBefore, notAfter time.Time) string {
+	now := time.Now()
+	days := int(notAfter.Sub(now).Hours() / 24)
+	switch {
+	case now.Before(notBefore):
+		return color.RedString("not valid yet")
+	case now.After(notAfter):
+		return color.RedString("expired %d days ago", -days)
+	case days < 7:
+		return color.RedString("expires in %d days", days)
+	case days < 30:
+		return color.YellowString("expires in %d days", days)
+	default:
+		return color.GreenString("expires in %d days", days)
+	}
+}
+
+func publicKeyType(key interface{}) string {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d bits", k.N.BitLen())
+	case *ecdsa.PublicKey:
+		if k.Curve == sm2.P256() {
+			return "SM2 256 bits"
+		}
+		return fmt.Sprintf("ECDSA %s", k.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return fmt.Sprintf("%T", key)
+	}
+}
+
+// spkiHash returns the base64 encoded SHA256 of the SubjectPublicKeyInfo, in the sha256//base64 pin format.
+func spkiHash(spki []byte) string {
+	sum := sha256.Sum256(spki)
+	return "sha256//" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// setupTLSOptions sets the protocol versions, cipher suites, curves, ALPN and SNI into the TLS config.
+func setupTLSOptions(c *tls.Config) {
+	var err error
+	if tlsMin != "" {
+		if c.MinVersion, err = parseTLSVersion(tlsMin); err != nil {
+			log.Fatalf("-tls-min: %v", err)
+		}
+	}
+	if tlsMax != "" {
+		if c.MaxVersion, err = parseTLSVersion(tlsMax); err != nil {
+			log.Fatalf("-tls-max: %v", err)
+		}
+	}
+	if tlsCiphers != "" {
+		if c.CipherSuites, err = parseCipherSuites(tlsCiphers); err != nil {
+			log.Fatalf("-ciphers: %v", err)
+		}
+	}
+	if tlsCurves != "" {
+		if c.CurvePreferences, err = parseCurves(tlsCurves); err != nil {
+			log.Fatalf("-curves: %v", err)
+		}
+	}
+	if tlsALPN != "" {
+		c.NextProtos = splitList(tlsALPN)
+	}
+	if tlsSNI != "" {
+		c.ServerName = tlsSNI
+	}
+	c.KeyLogWriter = openKeyLog()
+}
+
+func splitList(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' })
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10, "1.1": tls.VersionTLS11, "1.2": tls.VersionTLS12, "1.3": tls.VersionTLS13,
+}
+
+// parseTLSVersion parses the TLS version like 1.2, tls1.2 or TLSv1.2.
+func parseTLSVersion(s string) (uint16, error) {
+	v := strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(s), "tls"), "v")
+	if x, ok := tlsVersions[v]; ok {
+		return x, nil
+	}
+	return 0, fmt.Errorf("unknown TLS version %s, should be one of 1.0|1.1|1.2|1.3", s)
+}
+
+// parseCipherSuites parses the cipher suites by the names like TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, or the ids like 0xc02f,
+// the insecure ones are allowed for testing the legacy peers.
+func parseCipherSuites(s string) ([]uint16, error) {
+	var ids []uint16
+	for _, name := range splitList(s) {
+		if id, err := strconv.ParseUint(name, 0, 16); err == nil {
+			ids = append(ids, uint16(id))
+			continue
+		}
+
+		found := false
+		for _, c := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+			if strings.EqualFold(c.Name, name) {
+				ids, found = append(ids, c.ID), true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown cipher suite %s", name)
+		}
+	}
+	return ids, nil
+}
+
+var tlsCurveNames = map[string]tls.CurveID{
+	"x25519": tls.X25519, "p-256": tls.CurveP256, "p-384": tls.CurveP384, "p-521": tls.CurveP521,
+	"p256": tls.CurveP256, "p384": tls.CurveP384, "p521": tls.CurveP521,
+	"secp256r1": tls.CurveP256, "secp384r1": tls.CurveP384, "secp521r1": tls.CurveP521,
+}
+
+// parseCurves parses the curves by the names like X25519, P-256, or the ids like 4588 for the newer ones.
+func parseCurves(s string) ([]tls.CurveID, error) {
+	var ids []tls.CurveID
+	for _, name := range splitList(s) {
+		if id, err := strconv.ParseUint(name, 0, 16); err == nil {
+			ids = append(ids, tls.CurveID(id))
+		} else if id, ok := tlsCurveNames[strings.ToLower(name)]; ok {
+			ids = append(ids, id)
+		} else {
+			return nil, fmt.Errorf("unknown curve %s", name)
+		}
+	}
+	return ids, nil
+}
+
+// parsePins parses the -pin value like sha256//base64[;sha256//base64], the SHA256 hashes of the SubjectPublicKeyInfo.
+func parsePins(s string) ([][]byte, error) {
+	var pins [][]byte
+	for _, p := range strings.FieldsFunc(s, func(r rune) bool { return r == ';' || r == ',' || r == ' ' }) {
+		v, ok := strings.CutPrefix(p, "sha256//")
+		if !ok {
+			return nil, fmt.Errorf("bad pin %s, should be like sha256//base64", p)
+		}
+		sum, err := base64.StdEncoding.DecodeString(v)
+		if err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("bad pin %s, should be the base64 encoded SHA256", p)
+		}
+		pins = append(pins, sum)
+	}
+	return pins, nil
+}
+
+// setupPins checks the -pin in the VerifyConnection of the TLS config, so that every handshake is covered,
+// by the dialer, by net/http in the CONNECT tunnel of a proxy, or by QUIC.
+func setupPins(c *tls.Config) {
+	pins, err := parsePins(tlsPins)
+	if err != nil {
+		log.Fatalf("-pin: %v", err)
+	}
+	if len(pins) == 0 {
+		return
+	}
+
+	c.VerifyConnection = func(state tls.ConnectionState) error {
+		return checkPins(pins, x509Certificates(state.PeerCertificates))
+	}
+}
+
+// checkPins checks that the leaf or any certificate in the chain matches one of the pins,
+// it is checked even when the certificate verification is turned off.
+func checkPins(pins [][]byte, certs []*smx509.Certificate) error {
+	if len(pins) == 0 {
+		return nil
+	}
+
+	var got []string
+	for _, c := range certs {
+		sum := sha256.Sum256(c.RawSubjectPublicKeyInfo)
+		for _, pin := range pins {
+			if bytes.Equal(sum[:], pin) {
+				return nil
+			}
+		}
+		got = append(got, spkiHash(c.RawSubjectPublicKeyInfo)+" ("+c.Subject.String()+")")
+	}
+
+	return fmt.Errorf("public key pinning failed, none of the server certificates matches -pin, got %s", strings.Join(got, ", "))
+}
+
+var (
+	keyLogOnce   sync.Once
+	keyLogWriter io.Writer
+)
+
+// openKeyLog opens the -keylog or $SSLKEYLOGFILE file in the NSS key log format, shared by all the connections,
+// so that the captured traffic can be decrypted by Wireshark.
+func openKeyLog() io.Writer {
+	keyLogOnce.Do(func() {
+		if keyLogFile == "" {
+			return
+		}
+
+		f, err := os.OpenFile(keyLogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			log.Fatalf("open key log file %s: %v", keyLogFile, err)
+		}
+		log.Printf("TLS secrets are logged to %s, for debugging only", keyLogFile)
+		keyLogWriter = f
+	})
+	return keyLogWriter
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParseTLSOptions(t *testing.T) {
+	for s, want := range map[string]uint16{"1.2": tls.VersionTLS12, "tls1.3": tls.VersionTLS13, "TLSv1.0": tls.VersionTLS10} {
+		if v, err := parseTLSVersion(s); err != nil || v != want {
+			t.Errorf("parseTLSVersion(%s) = %x, %v", s, v, err)
+		}
+	}
+	if _, err := parseTLSVersion("1.4"); err == nil {
+		t.Error("parseTLSVersion(1.4) should fail")
+	}
+
+	ids, err := parseCipherSuites("tls_ecdhe_rsa_with_aes_128_gcm_sha256, TLS_RSA_WITH_RC4_128_SHA,0x009c")
+	if err != nil || len(ids) != 3 || ids[0] != tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 ||
+		ids[1] != tls.TLS_RSA_WITH_RC4_128_SHA || ids[2] != tls.TLS_RSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("parseCipherSuites = %x, %v", ids, err)
+	}
+
+	curves, err := parseCurves("X25519,P-256,secp384r1,4588")
+	if err != nil || len(curves) != 4 || curves[0] != tls.X25519 || curves[2] != tls.CurveP384 || curves[3] != 4588 {
+		t.Errorf("parseCurves = %v, %v", curves, err)
+	}
+}
+
+func TestParsePins(t *testing.T) {
+	pins, err := parsePins("sha256//es9R4Gu21mMa90L51reDMwccmcAp/RnSrzRfrFb8AL4=; sha256//Oiy+ouxu6zQ/pIH4R6BXskL15i2A3vp3ukSQzbxS278=")
+	if err != nil || len(pins) != 2 || len(pins[0]) != 32 {
+		t.Errorf("parsePins = %x, %v", pins, err)
+	}
+	for _, bad := range []string{"md5//abc", "sha256//abc", "sha256//es9R4Gu21mMa90L51reDMwccmcAp"} {
+		if _, err := parsePins(bad); err == nil {
+			t.Errorf("parsePins(%s) should fail", bad)
+		}
+	}
+}
+
+func TestLoadClientCertificatePKCS12(t *testing.T) {
+	// client.p12 is exported by openssl 3 with AES-256-CBC, the leaf first,
+	// client-ca-first.p12 has the CA certificate bag before the leaf.
+	for _, file := range []string{"testdata/client.p12", "testdata/client-ca-first.p12"} {
+		if _, err := loadClientCertificate(file, "", "wrong"); err == nil {
+			t.Errorf("%s with the wrong password should fail", file)
+		}
+
+		cert, err := loadClientCertificate(file, "", "secret")
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		if cert.Leaf.Subject.CommonName != "gurl-test-client" || len(cert.Certificate) != 2 {
+			t.Errorf("%s: bad leaf %s of %d certificates", file, cert.Leaf.Subject, len(cert.Certificate))
+		}
+		if ca, err := x509.ParseCertificate(cert.Certificate[1]); err != nil || ca.Subject.CommonName != "gurl-test-ca" {
+			t.Errorf("%s: bad chain %v", file, err)
+		}
+	}
+}
+
+// testChain returns the client certificate chain in client.p12, the leaf and the CA.
+func testChain(t *testing.T) []*x509.Certificate {
+	cert, err := loadClientCertificate("testdata/client.p12", "", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chain []*x509.Certificate
+	for _, der := range cert.Certificate {
+		c, _ := x509.ParseCertificate(der)
+		chain = append(chain, c)
+	}
+	return chain
+}
+
+func TestCheckPins(t *testing.T) {
+	certs := x509Certificates(testChain(t))
+	leafPin, caPin := spkiHash(certs[0].RawSubjectPublicKeyInfo), spkiHash(certs[1].RawSubjectPublicKeyInfo)
+	otherPin := "sha256//es9R4Gu21mMa90L51reDMwccmcAp/RnSrzRfrFb8AL4="
+
+	for _, c := range []struct {
+		pins string
+		ok   bool
+	}{
+		{leafPin, true},
+		{otherPin + ";" + caPin, true}, // matched on the CA certificate in the chain, not the leaf
+		{otherPin, false},
+		{"", true},
+	} {
+		pins, err := parsePins(c.pins)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = checkPins(pins, certs)
+		if (err == nil) != c.ok {
+			t.Errorf("checkPins(%s) = %v", c.pins, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), leafPin+" (CN=gurl-test-client)") {
+			t.Errorf("checkPins error should list the got pins: %v", err)
+		}
+	}
+}
+
+func TestPrintPeerCertificates(t *testing.T) {
+	chain := testChain(t)
+
+	old, stdout := printOption, os.Stdout
+	defer func() { printOption, os.Stdout = old, stdout }()
+	printOption = printPeerCerts
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	printPeerCertificates("TLS", x509Certificates(chain))
+	w.Close()
+	out, _ := io.ReadAll(r)
+
+	for _, want := range []string{
+		"option TLS.PeerCertificate[0]: CN=gurl-test-client\n  Issuer:       CN=gurl-test-ca\n",
+		"option TLS.PeerCertificate[1]: CN=gurl-test-ca\n",
+		"  SPKI SHA256:  " + spkiHash(chain[1].RawSubjectPublicKeyInfo) + "\n",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("output should contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestOpenKeyLog(t *testing.T) {
+	old := keyLogFile
+	defer func() { keyLogFile, keyLogOnce, keyLogWriter = old, sync.Once{}, nil }()
+
+	keyLogFile = filepath.Join(t.TempDir(), "keys.log")
+	keyLogOnce, keyLogWriter = sync.Once{}, nil
+	w := openKeyLog()
+	if w == nil || openKeyLog() != w {
+		t.Fatalf("key log writer should be opened once, got %v", w)
+	}
+	defer w.(io.Closer).Close()
+
+	fi, err := os.Stat(keyLogFile)
+	if err != nil || fi.Mode().Perm() != 0o600 {
+		t.Errorf("key log file %v, %v, want permissions 0600", fi, err)
+	}
+}
+
+func TestPinsThroughProxy(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	var connects atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		connects.Add(1)
+		dst, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer dst.Close()
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		defer conn.Close()
+		_, _ = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go func() { _, _ = io.Copy(dst, conn) }()
+		_, _ = io.Copy(conn, dst)
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	savedPins := tlsPins
+	defer func() { tlsPins = savedPins }()
+
+	get := func(pins string) error {
+		tlsPins = pins
+		req := NewRequest(ts.URL, http.MethodGet)
+		req.SetTLSClientConfig(createTLSConfig(true))
+		req.SetProxy(http.ProxyURL(proxyURL))
+		req.SetupTransport()
+		r, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+		rsp, err := req.Transport.RoundTrip(r)
+		if err == nil {
+			rsp.Body.Close()
+		}
+		return err
+	}
+
+	leafPin := spkiHash(ts.Certificate().RawSubjectPublicKeyInfo)
+	if err := get(leafPin); err != nil {
+		t.Errorf("matched pin: %v", err)
+	}
+	otherPin := "sha256//es9R4Gu21mMa90L51reDMwccmcAp/RnSrzRfrFb8AL4="
+	if err := get(otherPin); err == nil || !strings.Contains(err.Error(), "pinning failed") {
+		t.Errorf("mismatched pin: %v", err)
+	}
+	if n := connects.Load(); n != 2 {
+		t.Errorf("%d CONNECT requests, want 2", n)
+	}
+}
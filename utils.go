@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"hash"
 	"io"
@@ -125,3 +126,20 @@ func flagEnvVar(p *string, name, value, usage, envName string) {
 	}
 	fla9.StringVar(p, name, value, usage)
 }
+
+// limitedBuffer keeps at most max+1 bytes written, so that an overflow can be told by Len() > max,
+// and the writes never fail, like for the echoed body of -serve and the downloaded body checked by -expect.
+type limitedBuffer struct {
+	*bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max + 1 - b.Len(); room > 0 {
+		if len(p) < room {
+			room = len(p)
+		}
+		b.Buffer.Write(p[:room])
+	}
+	return len(p), nil
+}
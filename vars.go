@@ -5,6 +5,9 @@ import (
 	"io"
 	"os"
 	"regexp"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/bingoohuang/gg/pkg/iox"
 	"github.com/bingoohuang/gg/pkg/osx/env"
@@ -16,6 +19,9 @@ import (
 var (
 	valuer = NewValuer(env.Bool("INTERACTIVE", true))
 	gen    = jj.NewGenContext(valuer)
+	// valuerLock serializes the use of the shared valuer, by the suite requests built in parallel,
+	// and by the signers evaluating the variables in the round trips.
+	valuerLock sync.Mutex
 )
 
 func Eval(s string) string {
@@ -41,6 +47,30 @@ func Eval(s string) string {
 	return vars.ToString(vars.ParseExpr(lines).Eval(valuer))
 }
 
+// ExpandVars expands only the @name or @{name} references to the named variables, others are kept as they are,
+// so that no generator or interactive input is triggered.
+func ExpandVars(s string) string {
+	if len(valuer.Vars) == 0 || !strings.Contains(s, "@") {
+		return s
+	}
+
+	var b strings.Builder
+	for _, sub := range vars.ParseExpr(s) {
+		switch v := sub.(type) {
+		case *vars.SubTxt:
+			b.WriteString(v.Val)
+		case *vars.SubVar:
+			if x, ok := valuer.Vars[v.Name]; ok && v.Params == "" {
+				b.WriteString(x)
+			} else {
+				b.WriteString(v.Expr)
+			}
+		}
+	}
+
+	return b.String()
+}
+
 func eatBlanks(s string) (blanks, left string) {
 	for i, c := range s {
 		if c == ' ' || c == '\r' || c == '\n' {
@@ -56,6 +86,8 @@ func eatBlanks(s string) (blanks, left string) {
 
 type Valuer struct {
 	Map map[string]interface{}
+	// Vars holds the named variables, like the ones defined in .http files, which are kept across requests.
+	Vars map[string]string
 	*jj.GenContext
 	InteractiveMode bool
 }
@@ -63,11 +95,17 @@ type Valuer struct {
 func NewValuer(interactiveMode bool) *Valuer {
 	return &Valuer{
 		Map:             make(map[string]interface{}),
+		Vars:            make(map[string]string),
 		GenContext:      jj.NewGen(),
 		InteractiveMode: interactiveMode,
 	}
 }
 
+// SetVar sets a named variable which can be referenced by @name or @{name}.
+func (v *Valuer) SetVar(name, value string) {
+	v.Vars[name] = value
+}
+
 var cacheSuffix = regexp.MustCompile(`^(.+)_\d+`)
 
 func (v *Valuer) ClearCache() {
@@ -75,6 +113,10 @@ func (v *Valuer) ClearCache() {
 }
 
 func (v *Valuer) Value(name, params, expr string) interface{} {
+	if x, ok := v.Vars[name]; ok {
+		return x
+	}
+
 	pureName := name
 	subs := cacheSuffix.FindStringSubmatch(name)
 	if len(subs) > 0 {
@@ -84,7 +126,12 @@ func (v *Valuer) Value(name, params, expr string) interface{} {
 		}
 	}
 
-	x := jj.DefaultGen.Value(pureName, params, expr)
+	var x interface{}
+	if pureName == "now" {
+		x = nowUnix(params, expr)
+	} else {
+		x = jj.DefaultGen.Value(pureName, params, expr)
+	}
 	if x == expr && v.InteractiveMode { // 没有解析成功，进入命令行输入模式
 		x = GetVar(name)
 	}
@@ -95,6 +142,21 @@ func (v *Valuer) Value(name, params, expr string) interface{} {
 	return x
 }
 
+// nowUnix returns the unix seconds of now, with the optional offset like @now(+5m) or @now(-1h),
+// it is handy for the time claims like iat and exp.
+func nowUnix(params, expr string) interface{} {
+	t := time.Now()
+	if params = strings.TrimSpace(params); params != "" {
+		d, err := time.ParseDuration(strings.TrimPrefix(params, "+"))
+		if err != nil {
+			return expr
+		}
+		t = t.Add(d)
+	}
+
+	return t.Unix()
+}
+
 func GetVar(name string) string {
 	line, err := ReadLine(
 		WithPrompt(name+": "),